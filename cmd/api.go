@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var apiCmd = &cobra.Command{
+	Use:        "api",
+	Short:      "Start the management api server",
+	Deprecated: "use serve api instead",
+	Run: func(cmd *cobra.Command, args []string) {
+		runApi()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(apiCmd)
+}
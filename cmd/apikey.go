@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"proxy-pool/internal/cli"
+	"proxy-pool/pkg/auth"
+	"strings"
+	"text/tabwriter"
+)
+
+var apiKeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage api keys of the management api",
+}
+
+var apiKeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an api key and print its token",
+	Long: `Create an api key and print its token. The token is stored hashed and
+can not be shown again.
+
+Scopes: pool:read, credentials:read, pool:write, admin`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		scopeFlags, _ := cmd.Flags().GetStringSlice("scope")
+		scopes := make([]auth.Scope, 0, len(scopeFlags))
+		for _, s := range scopeFlags {
+			scope, err := auth.ParseScope(s)
+			if err != nil {
+				return err
+			}
+			scopes = append(scopes, scope)
+		}
+		c, cleanup := cli.NewCli()
+		defer cleanup()
+		key, token, err := c.CreateApiKey(context.Background(), name, scopes)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id:    %v\ntoken: %v\n", key.Id, token)
+		return nil
+	},
+}
+
+var apiKeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an api key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, cleanup := cli.NewCli()
+		defer cleanup()
+		return c.RevokeApiKey(context.Background(), args[0])
+	},
+}
+
+var apiKeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List api keys",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, cleanup := cli.NewCli()
+		defer cleanup()
+		keys, err := c.ListApiKeys(context.Background())
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED")
+		for _, k := range keys {
+			scopes := make([]string, 0, len(k.Scopes))
+			for _, s := range k.Scopes {
+				scopes = append(scopes, string(s))
+			}
+			_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", k.Id, k.Name, strings.Join(scopes, ","), k.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	apiKeyCreateCmd.Flags().String("name", "", "who or what the key is for")
+	apiKeyCreateCmd.Flags().StringSlice("scope", []string{string(auth.ScopePoolRead)}, "scope granted to the key, repeatable")
+	apiKeyCmd.AddCommand(apiKeyCreateCmd, apiKeyRevokeCmd, apiKeyListCmd)
+	rootCmd.AddCommand(apiKeyCmd)
+}
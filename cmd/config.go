@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+	"os"
+	"proxy-pool/config"
+	"proxy-pool/internal/core"
+	"proxy-pool/pkg/pool"
+	"reflect"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+	// the subcommands report a broken config themselves
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration and list every problem found",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := loadConfig()
+		if err != nil {
+			// the problems are the whole answer, the usage does not help with them
+			cmd.SilenceUsage = true
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "config is valid")
+		return nil
+	},
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration, secrets masked",
+	Long: `Print the effective configuration as yaml: the defaults, overridden by the
+config file, overridden by the environment. Passwords and secrets are masked.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if cfg == nil {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		settings, err := settingsOf(redacted(cfg))
+		if err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	},
+}
+
+// loadConfig reads the effective config and checks it, the settings of the sources included
+func loadConfig() (*config.Config, error) {
+	if configErr != nil {
+		return nil, configErr
+	}
+	return loadConfigFrom(viper.GetViper())
+}
+
+// loadConfigFrom decodes the config v has read and validates it
+func loadConfigFrom(v *viper.Viper) (*config.Config, error) {
+	cfg, err := core.LoadConfigFrom(v)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, err := range []error{cfg.Validate(), pool.ValidateSources(cfg.Sources)} {
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			problems = append(problems, invalid.Problems...)
+		}
+	}
+	if len(problems) > 0 {
+		return cfg, &config.ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// settingsOf converts cfg to the keys of the config file
+func settingsOf(cfg *config.Config) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	err := mapstructure.Decode(cfg, &settings)
+	if err != nil {
+		return nil, err
+	}
+	// list items are left as structs by the decoder, unset keys are left out to keep them short
+	fetchers := make([]map[string]interface{}, 0, len(cfg.Fetchers))
+	for _, f := range cfg.Fetchers {
+		m := map[string]interface{}{}
+		err = mapstructure.Decode(f, &m)
+		if err != nil {
+			return nil, err
+		}
+		fetchers = append(fetchers, withoutUnset(m))
+	}
+	sources := make([]map[string]interface{}, 0, len(cfg.Sources))
+	for _, source := range cfg.Sources {
+		m := map[string]interface{}{}
+		err = mapstructure.Decode(source, &m)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, withoutUnset(m))
+	}
+	settings["fetchers"], settings["sources"] = fetchers, sources
+	return settings, nil
+}
+
+func withoutUnset(m map[string]interface{}) map[string]interface{} {
+	for key, value := range m {
+		v := reflect.ValueOf(value)
+		if !v.IsValid() || v.IsZero() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0) {
+			delete(m, key)
+		}
+	}
+	return m
+}
+
+const masked = "********"
+
+// redacted returns a copy of cfg with the passwords and secrets masked
+func redacted(cfg *config.Config) *config.Config {
+	r := *cfg
+	if r.Redis.Password != "" {
+		r.Redis.Password = masked
+	}
+	if r.Webhook.Secret != "" {
+		r.Webhook.Secret = masked
+	}
+	r.Sources = make([]config.SourceConfig, len(cfg.Sources))
+	for i, source := range cfg.Sources {
+		if source.Password != "" {
+			source.Password = masked
+		}
+		r.Sources[i] = source
+	}
+	return &r
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd, configPrintCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"proxy-pool/config"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidateCmd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setupViper(viper.GetViper())
+	viper.SetConfigFile(file)
+	out := &bytes.Buffer{}
+	configValidateCmd.SetOut(out)
+	t.Cleanup(func() { configValidateCmd.SetOut(nil) })
+
+	err := os.WriteFile(file, []byte("proxy:\n  max_tries: 0\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	err = configValidateCmd.RunE(configValidateCmd, nil)
+	var invalid *config.ValidationError
+	if !errors.As(err, &invalid) || !strings.Contains(err.Error(), "max_tries") {
+		t.Errorf("RunE() of an invalid config error = %v, want the problems", err)
+	}
+
+	err = os.WriteFile(file, []byte("proxy:\n  max_tries: 3\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	err = configValidateCmd.RunE(configValidateCmd, nil)
+	if err != nil || !strings.Contains(out.String(), "config is valid") {
+		t.Errorf("RunE() of a valid config = %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"proxy-pool/internal/cli"
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <proxy>",
+	Short: "Remove a proxy from the pool",
+	Long: `Remove the proxy at the address of scheme://host:port or host:port from
+the pool. A source still listing it adds it again on its next run.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, cleanup := cli.NewCli()
+		defer cleanup()
+		return c.Delete(context.Background(), args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"proxy-pool/internal/cli"
+	"proxy-pool/pkg/pool"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the pool in a format other tools can read",
+	Long: `Export the pool as plain text, json, csv, a clash proxies block,
+a proxychains config or a pac file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formatFlag, _ := cmd.Flags().GetString("format")
+		format, err := pool.ParseFormat(formatFlag)
+		if err != nil {
+			return err
+		}
+		filter, err := filterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		var out io.Writer = os.Stdout
+		output, _ := cmd.Flags().GetString("output")
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		c, cleanup := cli.NewCli()
+		defer cleanup()
+		return c.Export(context.Background(), out, format, filter)
+	},
+}
+
+func filterFromFlags(cmd *cobra.Command) (pool.Filter, error) {
+	filter := pool.Filter{}
+	filter.Country, _ = cmd.Flags().GetString("country")
+	filter.Limit, _ = cmd.Flags().GetInt("limit")
+	t, _ := cmd.Flags().GetString("type")
+	if t != "" {
+		parsed, err := pool.ParseType(t)
+		if err != nil {
+			return filter, err
+		}
+		filter.Type = parsed
+	}
+	return filter, nil
+}
+
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("type", "", "only proxies of this type (http, https, socks4, socks5)")
+	cmd.Flags().String("country", "", "only proxies from this country")
+	cmd.Flags().Int("limit", 0, "maximum number of proxies, 0 means no limit")
+}
+
+func init() {
+	exportCmd.Flags().StringP("format", "f", "text", "output format (text, json, csv, clash, proxychains, pac)")
+	exportCmd.Flags().StringP("output", "o", "", "write to file instead of stdout")
+	addFilterFlags(exportCmd)
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"proxy-pool/internal/cli"
+	"text/tabwriter"
+	"time"
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "Run the fetchers once and print what they found",
+	Long: `Run the fetchers once and print what they found. New proxies are put
+on the checker queue, a running server checks them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source, _ := cmd.Flags().GetString("source")
+		c, cleanup := cli.NewCli()
+		defer cleanup()
+		results, err := c.Fetch(source)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tFETCHED\tDUPLICATES\tENQUEUED\tDURATION\tERROR")
+		for _, r := range results {
+			message := ""
+			if r.Err != nil {
+				message = r.Err.Error()
+			}
+			_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n",
+				r.Name, r.Count, r.Duplicates, r.Enqueued, r.Duration.Round(time.Millisecond), message)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	fetchCmd.Flags().String("source", "", "only run the fetcher or source with this name")
+	rootCmd.AddCommand(fetchCmd)
+}
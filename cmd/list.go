@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"proxy-pool/internal/cli"
+	"text/tabwriter"
+	"time"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the proxies in the pool",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := filterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		c, cleanup := cli.NewCli()
+		defer cleanup()
+		proxies, err := c.List(context.Background(), filter)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "PROXY\tCOUNTRY\tLATENCY\tSOURCE\tLAST CHECKED")
+		for _, p := range proxies {
+			lastChecked := "-"
+			if p.LastChecked > 0 {
+				lastChecked = time.Unix(p.LastChecked, 0).Format("2006-01-02 15:04")
+			}
+			_, _ = fmt.Fprintf(w, "%v://%v:%v\t%v\t%v\t%v\t%v\n", p.Type, p.Ip, p.Port, p.Country, p.Latency, p.Source, lastChecked)
+		}
+		_ = w.Flush()
+		fmt.Printf("%v proxies\n", len(proxies))
+		return nil
+	},
+}
+
+func init() {
+	addFilterFlags(listCmd)
+	rootCmd.AddCommand(listCmd)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"proxy-pool/pkg/log"
+	"proxy-pool/pkg/metrics"
+)
+
+// serveMetrics exposes the metrics of the proxy and worker roles on metrics.listen,
+// the api serves them itself, so does serve all
+func serveMetrics(ctx context.Context) {
+	cfg, err := loadConfig()
+	if err != nil || cfg.Metrics.Listen == "" {
+		return
+	}
+	err = metrics.Serve(ctx, cfg.Metrics.Listen)
+	if err != nil {
+		log.Logger.Error("metrics server failed", zap.Error(err))
+	}
+}
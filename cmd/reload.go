@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// editors write a file in several steps, the reload starts once they settle
+const configWatchDelay = time.Second
+
+// watchConfig calls apply with the config read again on SIGHUP and whenever the config file
+// or the sources file changes, until ctx is done. A config which fails to load or validate
+// is logged and the running one is kept
+func watchConfig(ctx context.Context, apply func(cfg *config.Config)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Logger.Warn("config files are not watched, reload with SIGHUP", zap.Error(err))
+	} else {
+		defer watcher.Close()
+	}
+	files := map[string]bool{}
+	watch := func(file string) {
+		if watcher == nil || file == "" {
+			return
+		}
+		file, _ = filepath.Abs(file)
+		if files[file] {
+			return
+		}
+		files[file] = true
+		// the directory is watched, files replaced by a rename are picked up too
+		err := watcher.Add(filepath.Dir(file))
+		if err != nil {
+			log.Logger.Warn("failed to watch config file", zap.String("file", file), zap.Error(err))
+		}
+	}
+	watch(viper.ConfigFileUsed())
+	if cfg, err := loadConfig(); err == nil {
+		watch(cfg.SourcesFile)
+	}
+	reload := func(trigger string) {
+		cfg, err := reloadConfig()
+		if err != nil {
+			log.Logger.Error("rejected new config, the running one is kept", zap.String("trigger", trigger), zap.Error(err))
+			return
+		}
+		log.Logger.Info("applying new config", zap.String("trigger", trigger))
+		apply(cfg)
+		watch(cfg.SourcesFile)
+	}
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if watcher != nil {
+		events, errs = watcher.Events, watcher.Errors
+	}
+	timer := time.NewTimer(configWatchDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-signals:
+			reload("SIGHUP")
+		case event := <-events:
+			file, _ := filepath.Abs(event.Name)
+			if event.Op != fsnotify.Chmod && files[file] {
+				timer.Reset(configWatchDelay)
+			}
+		case err := <-errs:
+			log.Logger.Warn("config watch failed", zap.Error(err))
+		case <-timer.C:
+			reload("file change")
+		}
+	}
+}
+
+// reloadConfig reads the config file again and returns the config once it is valid.
+// The file is read into a viper of its own, the global one only takes it once it passed validation
+func reloadConfig() (*config.Config, error) {
+	v := viper.New()
+	setupViper(v)
+	var content []byte
+	file := viper.ConfigFileUsed()
+	if file != "" {
+		var err error
+		content, err = os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		v.SetConfigType(strings.TrimPrefix(filepath.Ext(file), "."))
+		err = v.ReadConfig(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+	}
+	cfg, err := loadConfigFrom(v)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		err = viper.ReadConfig(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
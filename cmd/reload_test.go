@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadConfig_keepsRunningConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		err := os.WriteFile(file, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("proxy:\n  max_tries: 5\n")
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setupViper(viper.GetViper())
+	viper.SetConfigFile(file)
+	err := viper.ReadInConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{
+		"invalid value": "proxy:\n  max_tries: 0\n",
+		"broken yaml":   "proxy: [max_tries\n",
+	} {
+		write(content)
+		_, err := reloadConfig()
+		if err == nil {
+			t.Errorf("reloadConfig() with %v returned no error", name)
+		}
+		if got := viper.GetInt("proxy.max_tries"); got != 5 {
+			t.Errorf("proxy.max_tries after a rejected %v = %v, want 5", name, got)
+		}
+	}
+
+	write("proxy:\n  max_tries: 7\n")
+	cfg, err := reloadConfig()
+	if err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	if cfg.Proxy.MaxTries != 7 || viper.GetInt("proxy.max_tries") != 7 {
+		t.Errorf("proxy.max_tries = %v, global %v, want 7", cfg.Proxy.MaxTries, viper.GetInt("proxy.max_tries"))
+	}
+}
@@ -16,11 +16,12 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
-	"log"
 	"os"
-	"proxy-pool/internal/proxy"
+	"proxy-pool/config"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -30,10 +31,21 @@ var cfgFile string
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "proxy-pool",
-	Short: "A brief description of your application",
-	Run: func(cmd *cobra.Command, args []string) {
-		server := proxy.NewProxy()
-		log.Fatal(server.Start())
+	Short: "Proxy pool which fetches, checks and serves proxies",
+	Long: `Proxy pool which fetches, checks and serves proxies.
+
+Each role runs on its own: serve proxy, serve api, worker fetcher and
+worker checker. serve all runs every role in one process for development.
+
+Settings are read from ./config.yaml, see config.example.yaml, and can be
+overridden by environment variables or a .env file.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := loadConfig()
+		if err != nil {
+			// the usage does not help with a broken config
+			cmd.SilenceUsage = true
+		}
+		return err
 	},
 }
 
@@ -53,27 +65,65 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.yaml)")
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file, yaml, toml or json (default is ./config.yaml)")
 }
 
-// initConfig reads in config file and ENV variables if set.
+// configErr is set when the config could not be read, commands report it before they run
+var configErr error
+
+// initConfig reads the config file, the .env file and the environment.
+// Environment variables are named after the keys, REDIS_ADDR overrides redis.addr
 func initConfig() {
+	err := loadEnvFile(".env")
+	if err != nil {
+		configErr = err
+		return
+	}
+	setupViper(viper.GetViper())
+
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
 	} else {
 		viper.AddConfigPath("./")
-		viper.SetConfigFile(".env")
+		viper.SetConfigName("config")
 	}
+	err = viper.ReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	switch {
+	case err == nil:
+		// stdout is left to the output of the commands
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	case errors.As(err, &notFound):
+		// the defaults and the environment are enough
+	default:
+		configErr = fmt.Errorf("config file: %w", err)
+	}
+}
 
-	viper.AutomaticEnv() // read in environment variables that match
+// setupViper applies the defaults and the environment overrides to v
+func setupViper(v *viper.Viper) {
+	config.SetDefaults(v)
+	config.BindEnv(v)
+}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+// loadEnvFile exports the variables of a dotenv file which are not set in the environment
+func loadEnvFile(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("env")
+	err := v.ReadInConfig()
+	if err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	for _, key := range v.AllKeys() {
+		name := strings.ToUpper(key)
+		if _, set := os.LookupEnv(name); !set {
+			_ = os.Setenv(name, v.GetString(key))
+		}
 	}
+	return nil
 }
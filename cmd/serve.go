@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"os/signal"
+	"proxy-pool/config"
+	"proxy-pool/internal/api"
+	"proxy-pool/internal/proxy"
+	"proxy-pool/internal/worker"
+	"sync"
+	"syscall"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start a server",
+}
+
+var serveProxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Start the forward proxy on :3001",
+	Long: `Start the forward proxy on :3001.
+
+The tries per tunnel and the dial timeout are reloaded on SIGHUP and when
+the config file changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := shutdownContext()
+		defer stop()
+		p, cleanup := proxy.NewProxy()
+		go watchConfig(ctx, p.Reload)
+		go serveMetrics(ctx)
+		err := p.Start(ctx)
+		cleanup()
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var serveApiCmd = &cobra.Command{
+	Use:   "api",
+	Short: "Start the management api on :3002 and grpc on :3003",
+	Long: `Start the management api on :3002 and grpc on :3003.
+
+Fetches asked for through the api are run by the leading fetcher worker.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runApi()
+	},
+}
+
+var serveAllCmd = &cobra.Command{
+	Use:   "all",
+	Short: "Run every role in one process, for development",
+	Long: `Run the proxy, the management api, the fetcher worker and the checker
+worker in one process. Production deployments run the roles as separate
+replicas instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := shutdownContext()
+		defer stop()
+		w, cleanupWorker := worker.NewWorker()
+		p, cleanupProxy := proxy.NewProxy()
+		s, cleanupApi := api.NewApiServer()
+		go watchConfig(ctx, func(cfg *config.Config) {
+			w.Reload(cfg)
+			p.Reload(cfg)
+		})
+		var roles sync.WaitGroup
+		errs := make(chan error, 2)
+		run := func(role func(ctx context.Context)) {
+			roles.Add(1)
+			go func() {
+				defer roles.Done()
+				role(ctx)
+			}()
+		}
+		// a server failing to start stops the other roles
+		serve := func(start func(ctx context.Context) error) func(ctx context.Context) {
+			return func(ctx context.Context) {
+				err := start(ctx)
+				if err != nil {
+					errs <- err
+					stop()
+				}
+			}
+		}
+		run(w.StartFetcher)
+		run(w.StartChecker)
+		run(serve(p.Start))
+		run(serve(s.Start))
+		roles.Wait()
+		cleanupApi()
+		cleanupProxy()
+		cleanupWorker()
+		select {
+		case err := <-errs:
+			log.Fatal(err)
+		default:
+		}
+	},
+}
+
+// shutdownContext is done on SIGINT or SIGTERM, the roles then stop gracefully
+func shutdownContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func runApi() {
+	ctx, stop := shutdownContext()
+	defer stop()
+	s, cleanup := api.NewApiServer()
+	err := s.Start(ctx)
+	cleanup()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func init() {
+	serveCmd.AddCommand(serveProxyCmd, serveApiCmd, serveAllCmd)
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"proxy-pool/internal/worker"
+)
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Run a background role of the pool",
+}
+
+var workerFetcherCmd = &cobra.Command{
+	Use:   "fetcher",
+	Short: "Schedule the fetchers, alerts and expiry",
+	Long: `Schedule the fetchers, alerts and expiry. Any number of replicas may run,
+only the one holding the leader lock in redis schedules, another one takes
+over when it is gone.
+
+The fetchers and their schedules are reloaded on SIGHUP and when the config
+or sources file changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := shutdownContext()
+		defer stop()
+		w, cleanup := worker.NewWorker()
+		defer cleanup()
+		go watchConfig(ctx, w.ReloadFetchers)
+		go serveMetrics(ctx)
+		w.StartFetcher(ctx)
+	},
+}
+
+var workerCheckerCmd = &cobra.Command{
+	Use:   "checker",
+	Short: "Check the proxies queued by the fetchers",
+	Long: `Check the proxies queued by the fetchers. Replicas share the queue, run
+more of them to check faster.
+
+The check url and timeout are reloaded on SIGHUP and when the config file
+changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := shutdownContext()
+		defer stop()
+		w, cleanup := worker.NewWorker()
+		defer cleanup()
+		go watchConfig(ctx, w.ReloadChecker)
+		go serveMetrics(ctx)
+		w.StartChecker(ctx)
+	},
+}
+
+func init() {
+	workerCmd.AddCommand(workerFetcherCmd, workerCheckerCmd)
+	rootCmd.AddCommand(workerCmd)
+}
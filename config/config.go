@@ -1,7 +1,182 @@
 package config
 
+import "time"
+
+// Config is read from a yaml file, every key can be overridden by an environment variable
+// named after its path, e.g. REDIS_ADDR for redis.addr
 type Config struct {
-	RedisAddr         string `mapstructure:"redis_addr"`
-	RedisPassword     string `mapstructure:"redis_password"`
-	RedisDb           int    `mapstructure:"redis_db"`
-}
\ No newline at end of file
+	Redis   RedisConfig   `mapstructure:"redis"`
+	Proxy   ProxyConfig   `mapstructure:"proxy"`
+	Api     ApiConfig     `mapstructure:"api"`
+	Checker CheckerConfig `mapstructure:"checker"`
+	// defaults of the fetchers and sources below
+	Fetcher FetcherDefaults `mapstructure:"fetcher"`
+	Pac     PacConfig       `mapstructure:"pac"`
+	Webhook WebhookConfig   `mapstructure:"webhook"`
+	Alert   AlertConfig     `mapstructure:"alert"`
+	Expiry  ExpiryConfig    `mapstructure:"expiry"`
+	Leader  LeaderConfig    `mapstructure:"leader"`
+	Metrics MetricsConfig   `mapstructure:"metrics"`
+
+	// on SIGTERM open tunnels, requests and checks get this long to finish before they are cut
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+	// yaml file declaring the sources and fetcher settings below, see sources.example.yaml
+	SourcesFile string `mapstructure:"sources_file"`
+	// settings of the built-in fetchers, matched by name
+	Fetchers []FetcherConfig `mapstructure:"fetchers"`
+	Sources  []SourceConfig  `mapstructure:"sources"`
+}
+
+type RedisConfig struct {
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	Db       int    `mapstructure:"db"`
+}
+
+type ProxyConfig struct {
+	// address the forward proxy listens on
+	Listen string `mapstructure:"listen"`
+	// upstreams tried for one tunnel before the client gets an error
+	MaxTries int `mapstructure:"max_tries"`
+	// time to open a tunnel through the upstreams, all tries included
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	// one record is written per tunnel
+	AccessLog AccessLogConfig `mapstructure:"access_log"`
+}
+
+type AccessLogConfig struct {
+	// file the records are written to, empty writes them to the application log
+	Path string `mapstructure:"path"`
+	// the file is rotated once it reaches this size
+	MaxSizeMb int `mapstructure:"max_size_mb"`
+	// rotated files kept, 0 keeps all
+	MaxBackups int `mapstructure:"max_backups"`
+	// rotated files are removed after this many days, 0 keeps them
+	MaxAgeDays int `mapstructure:"max_age_days"`
+}
+
+type ApiConfig struct {
+	// address of the management api
+	Listen string `mapstructure:"listen"`
+	// address of the grpc api
+	GrpcListen string `mapstructure:"grpc_listen"`
+	// accept api requests without an api key, for local development only
+	AuthDisabled bool `mapstructure:"auth_disabled"`
+}
+
+type CheckerConfig struct {
+	// a proxy passes when it fetches this url with status 200
+	Url     string        `mapstructure:"url"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// checks running at once in each checker
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+type FetcherDefaults struct {
+	// cron expression with optional seconds
+	Schedule string        `mapstructure:"schedule"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+type PacConfig struct {
+	// domain patterns served through the pool by the pac file, comma separated in env
+	Domains []string `mapstructure:"domains"`
+	// address of the front proxy written to the pac file, defaults to the requested host
+	ProxyAddr string `mapstructure:"proxy_addr"`
+}
+
+type WebhookConfig struct {
+	// urls receiving a json POST when a pool health threshold is crossed, comma separated in env
+	Urls []string `mapstructure:"urls"`
+	// signs webhook bodies with hmac sha256 when set
+	Secret  string `mapstructure:"secret"`
+	Retries int    `mapstructure:"retries"`
+}
+
+type AlertConfig struct {
+	// alert when the pool has fewer proxies, 0 disables
+	MinPoolSize int `mapstructure:"min_pool_size"`
+	// alert after this many failed runs in a row of one fetcher, 0 disables
+	FetcherFailures int `mapstructure:"fetcher_failures"`
+	// alert when this ratio of upstream dials fails within the interval, 0 disables
+	ErrorRate float64 `mapstructure:"error_rate"`
+	// how often health is evaluated, also the minimum time between two identical alerts
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+type ExpiryConfig struct {
+	// evict proxies without a passed check for this long, 0 keeps them
+	Unchecked time.Duration `mapstructure:"unchecked"`
+	// evict proxies no source has listed for this long, 0 keeps them
+	Unseen time.Duration `mapstructure:"unseen"`
+	// how often stale proxies are looked for
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+type LeaderConfig struct {
+	// the fetcher leader gives up its lock when it has not renewed it for this long
+	LockTtl time.Duration `mapstructure:"lock_ttl"`
+}
+
+type MetricsConfig struct {
+	// address the proxy and worker roles serve /metrics on, empty disables it.
+	// The api serves /metrics on its own address
+	Listen string `mapstructure:"listen"`
+}
+
+// FetcherConfig controls when a fetcher runs and how much it may return
+type FetcherConfig struct {
+	Name string `mapstructure:"name"`
+	// defaults to true, except for the built-in proxyhub fetcher
+	Enabled *bool `mapstructure:"enabled"`
+	// cron expression with optional seconds, defaults to fetcher.schedule
+	Schedule string `mapstructure:"schedule"`
+	// a run is abandoned after this long, defaults to fetcher.timeout
+	Timeout time.Duration `mapstructure:"timeout"`
+	// only the first results of a run are kept, 0 keeps all
+	MaxResults int `mapstructure:"max_results"`
+	// send the requests through proxies of the pool, for sites blocking our addresses
+	ViaPool bool `mapstructure:"via_pool"`
+	// upstreams tried after the first one failed a request, defaults to 3
+	ViaPoolRetries int `mapstructure:"via_pool_retries"`
+}
+
+// SourceConfig declares a proxy list which is scraped without a dedicated fetcher type
+type SourceConfig struct {
+	FetcherConfig `mapstructure:",squash"`
+	Url           string `mapstructure:"url"`
+	// text, json, html, file, gateway or subscription
+	Parser string `mapstructure:"parser"`
+	// proxy type used when the source does not tell, defaults to http
+	Type string `mapstructure:"type"`
+
+	// text: regular expression with the named groups ip and port, optionally type and country
+	Pattern string `mapstructure:"pattern"`
+	// json: dot separated path to the array of proxies, empty when the body is the array
+	Path string `mapstructure:"path"`
+	// json: item field holding the ip, port, type and country, keyed by those names
+	Fields map[string]string `mapstructure:"fields"`
+	// html: css selectors of the table rows and of the cells in a row
+	RowSelector  string `mapstructure:"row_selector"`
+	CellSelector string `mapstructure:"cell_selector"`
+	// html: cell index holding the ip, port, type and country, keyed by those names
+	Columns map[string]int `mapstructure:"columns"`
+
+	// file: files or globs, they are watched and read again when they change
+	Paths []string `mapstructure:"paths"`
+	// file: lines, csv or json, by default taken from the file extension
+	Format string `mapstructure:"format"`
+	// file: proxies which disappear from the files leave the pool, max_results is ignored
+	Sync bool `mapstructure:"sync"`
+
+	// gateway: host:port of a rotating backconnect gateway
+	Gateway string `mapstructure:"gateway"`
+	// gateway: username template where {session} and {country} are replaced for each exit
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// gateway: countries to build exits for, the username needs {country} when set
+	Countries []string `mapstructure:"countries"`
+	// gateway: exits per country, defaults to 10
+	Sessions int `mapstructure:"sessions"`
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"github.com/spf13/viper"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// defaultConfig decodes the defaults and the environment
+func defaultConfig(t *testing.T) *Config {
+	t.Helper()
+	v := viper.New()
+	SetDefaults(v)
+	BindEnv(v)
+	cfg := &Config{}
+	err := v.Unmarshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// setEnv sets an environment variable for the rest of the test
+func setEnv(t *testing.T, name, value string) {
+	t.Helper()
+	previous, set := os.LookupEnv(name)
+	_ = os.Setenv(name, value)
+	t.Cleanup(func() {
+		if set {
+			_ = os.Setenv(name, previous)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := defaultConfig(t)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() of the defaults = %v", err)
+	}
+
+	cfg.Proxy.MaxTries = 0
+	cfg.Api.Listen = "3002"
+	cfg.Checker.Url = "ftp://check.example.com"
+	cfg.Fetcher.Schedule = "every minute"
+	cfg.Alert.ErrorRate = 2
+	cfg.Fetchers = []FetcherConfig{{Name: "a"}, {Name: "a"}}
+	cfg.Sources = []SourceConfig{{}}
+	err := cfg.Validate()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Validate() error = %v, want a ValidationError", err)
+	}
+	want := []string{
+		"proxy.max_tries must be at least 1, got 0",
+		`api.listen must be host:port or :port, got "3002"`,
+		`checker.url must be an http or https url, got "ftp://check.example.com"`,
+		"fetcher.schedule is not a valid cron expression: expected 5 to 6 fields, found 2: [every minute]",
+		"alert.error_rate must be between 0 and 1, got 2",
+		"fetchers[1] (a): the name is used twice",
+		"sources[0].name is required",
+	}
+	if !reflect.DeepEqual(invalid.Problems, want) {
+		t.Errorf("Validate() problems = %q, want %q", invalid.Problems, want)
+	}
+}
+
+func TestBindEnv(t *testing.T) {
+	setEnv(t, "REDIS_ADDR", "redis:6379")
+	setEnv(t, "PROXY_ACCESS_LOG_MAX_BACKUPS", "3")
+	setEnv(t, "EXPIRE_UNCHECKED", "6h")
+	setEnv(t, "EXPIRE_UNSEEN", "1h")
+	setEnv(t, "EXPIRY_UNSEEN", "2h")
+
+	cfg := defaultConfig(t)
+	if cfg.Redis.Addr != "redis:6379" {
+		t.Errorf("redis.addr = %q, want the value of REDIS_ADDR", cfg.Redis.Addr)
+	}
+	if cfg.Proxy.AccessLog.MaxBackups != 3 {
+		t.Errorf("proxy.access_log.max_backups = %v, want the value of PROXY_ACCESS_LOG_MAX_BACKUPS", cfg.Proxy.AccessLog.MaxBackups)
+	}
+	if cfg.Expiry.Unchecked != time.Hour*6 {
+		t.Errorf("expiry.unchecked = %v, want the value of the former EXPIRE_UNCHECKED", cfg.Expiry.Unchecked)
+	}
+	if cfg.Expiry.Unseen != time.Hour*2 {
+		t.Errorf("expiry.unseen = %v, want EXPIRY_UNSEEN over EXPIRE_UNSEEN", cfg.Expiry.Unseen)
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaults are the values of keys set neither in the file nor in the environment.
+// Every key is listed, viper only looks up the environment variables of keys it knows
+var defaults = map[string]interface{}{
+	"redis.addr":     "localhost:6379",
+	"redis.password": "",
+	"redis.db":       0,
+
+	"proxy.listen":       ":3001",
+	"proxy.max_tries":    5,
+	"proxy.dial_timeout": time.Second * 30,
+
+	"proxy.access_log.path":         "",
+	"proxy.access_log.max_size_mb":  100,
+	"proxy.access_log.max_backups":  10,
+	"proxy.access_log.max_age_days": 30,
+
+	"api.listen":        ":3002",
+	"api.grpc_listen":   ":3003",
+	"api.auth_disabled": false,
+
+	"checker.url":         "https://m.tiktok.com",
+	"checker.timeout":     time.Second * 10,
+	"checker.concurrency": 20,
+
+	"fetcher.schedule": "50 * * * * *",
+	"fetcher.timeout":  time.Minute * 2,
+
+	"pac.domains":    []string{},
+	"pac.proxy_addr": "",
+
+	"webhook.urls":    []string{},
+	"webhook.secret":  "",
+	"webhook.retries": 3,
+
+	"alert.min_pool_size":    0,
+	"alert.fetcher_failures": 0,
+	"alert.error_rate":       0.0,
+	"alert.interval":         time.Minute,
+
+	"expiry.unchecked": time.Duration(0),
+	"expiry.unseen":    time.Duration(0),
+	"expiry.interval":  time.Minute * 10,
+
+	"leader.lock_ttl": time.Second * 30,
+
+	"metrics.listen": ":3004",
+
+	"shutdown_timeout": time.Second * 30,
+
+	"sources_file": "",
+}
+
+// renamedEnv lists the environment variables of keys which had another name before,
+// the current name wins when both are set
+var renamedEnv = map[string][]string{
+	"expiry.unchecked": {"EXPIRE_UNCHECKED"},
+	"expiry.unseen":    {"EXPIRE_UNSEEN"},
+}
+
+// SetDefaults registers the default of every key on v
+func SetDefaults(v *viper.Viper) {
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+}
+
+// BindEnv lets the environment override the keys of v, REDIS_ADDR overrides redis.addr
+func BindEnv(v *viper.Viper) {
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for key, names := range renamedEnv {
+		if _, set := os.LookupEnv(strings.ToUpper(strings.ReplaceAll(key, ".", "_"))); set {
+			continue
+		}
+		for _, name := range names {
+			if _, set := os.LookupEnv(name); set {
+				_ = v.BindEnv(key, name)
+				break
+			}
+		}
+	}
+}
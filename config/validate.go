@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ScheduleParser reads the schedules of the fetchers, seconds are optional
+var ScheduleParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ValidationError lists every problem found in a config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Validate checks the values which would otherwise fail once they are used.
+// The parser specific settings of the sources are checked by the pool
+func (c *Config) Validate() error {
+	v := &validator{}
+	v.check(c.Redis.Addr != "", "redis.addr is required")
+	v.address("proxy.listen", c.Proxy.Listen)
+	v.check(c.Proxy.MaxTries > 0, "proxy.max_tries must be at least 1, got %v", c.Proxy.MaxTries)
+	v.check(c.Proxy.DialTimeout > 0, "proxy.dial_timeout must be positive, got %v", c.Proxy.DialTimeout)
+	v.check(c.Proxy.AccessLog.MaxSizeMb > 0, "proxy.access_log.max_size_mb must be at least 1, got %v", c.Proxy.AccessLog.MaxSizeMb)
+	v.check(c.Proxy.AccessLog.MaxBackups >= 0, "proxy.access_log.max_backups must not be negative, got %v", c.Proxy.AccessLog.MaxBackups)
+	v.check(c.Proxy.AccessLog.MaxAgeDays >= 0, "proxy.access_log.max_age_days must not be negative, got %v", c.Proxy.AccessLog.MaxAgeDays)
+	v.address("api.listen", c.Api.Listen)
+	v.address("api.grpc_listen", c.Api.GrpcListen)
+	v.url("checker.url", c.Checker.Url)
+	v.check(c.Checker.Timeout > 0, "checker.timeout must be positive, got %v", c.Checker.Timeout)
+	v.check(c.Checker.Concurrency > 0, "checker.concurrency must be at least 1, got %v", c.Checker.Concurrency)
+	v.schedule("fetcher.schedule", c.Fetcher.Schedule)
+	v.check(c.Fetcher.Timeout > 0, "fetcher.timeout must be positive, got %v", c.Fetcher.Timeout)
+	for i, u := range c.Webhook.Urls {
+		v.url(fmt.Sprintf("webhook.urls[%v]", i), u)
+	}
+	v.check(c.Webhook.Retries >= 0, "webhook.retries must not be negative, got %v", c.Webhook.Retries)
+	v.check(c.Alert.ErrorRate >= 0 && c.Alert.ErrorRate <= 1, "alert.error_rate must be between 0 and 1, got %v", c.Alert.ErrorRate)
+	v.check(c.Alert.Interval >= 0, "alert.interval must not be negative, got %v", c.Alert.Interval)
+	v.check(c.Expiry.Unchecked >= 0, "expiry.unchecked must not be negative, got %v", c.Expiry.Unchecked)
+	v.check(c.Expiry.Unseen >= 0, "expiry.unseen must not be negative, got %v", c.Expiry.Unseen)
+	v.check(c.Expiry.Interval >= 0, "expiry.interval must not be negative, got %v", c.Expiry.Interval)
+	v.check(c.Leader.LockTtl >= 0, "leader.lock_ttl must not be negative, got %v", c.Leader.LockTtl)
+	if c.Metrics.Listen != "" {
+		v.address("metrics.listen", c.Metrics.Listen)
+	}
+	v.check(c.ShutdownTimeout >= 0, "shutdown_timeout must not be negative, got %v", c.ShutdownTimeout)
+
+	names := map[string]bool{}
+	fetchers := make([]FetcherConfig, 0, len(c.Fetchers)+len(c.Sources))
+	fetchers = append(fetchers, c.Fetchers...)
+	for _, source := range c.Sources {
+		fetchers = append(fetchers, source.FetcherConfig)
+	}
+	for i, f := range fetchers {
+		key := fmt.Sprintf("fetchers[%v]", i)
+		if i >= len(c.Fetchers) {
+			key = fmt.Sprintf("sources[%v]", i-len(c.Fetchers))
+		}
+		if f.Name == "" {
+			v.problem("%v.name is required", key)
+			continue
+		}
+		key = fmt.Sprintf("%v (%v)", key, f.Name)
+		v.check(!names[f.Name], "%v: the name is used twice", key)
+		names[f.Name] = true
+		if f.Schedule != "" {
+			v.schedule(key+".schedule", f.Schedule)
+		}
+		v.check(f.Timeout >= 0, "%v.timeout must not be negative, got %v", key, f.Timeout)
+		v.check(f.MaxResults >= 0, "%v.max_results must not be negative, got %v", key, f.MaxResults)
+	}
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) problem(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.problem(format, args...)
+	}
+}
+
+func (v *validator) address(key, addr string) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		v.problem("%v must be host:port or :port, got %q", key, addr)
+	}
+}
+
+func (v *validator) url(key, s string) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.problem("%v must be an http or https url, got %q", key, s)
+	}
+}
+
+func (v *validator) schedule(key, s string) {
+	if _, err := ScheduleParser.Parse(s); err != nil {
+		v.problem("%v is not a valid cron expression: %v", key, err)
+	}
+}
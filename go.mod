@@ -3,14 +3,22 @@ module proxy-pool
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/elazarl/goproxy v0.0.0-20210110162100-a92cc753f88e // indirect
+	github.com/fsnotify/fsnotify v1.4.9
+	github.com/getkin/kin-openapi v0.94.0
 	github.com/go-redis/redis/v8 v8.8.0
 	github.com/gocolly/colly/v2 v2.1.0
 	github.com/google/wire v0.5.0
 	github.com/mitchellh/mapstructure v1.4.1
-	github.com/robfig/cron/v3 v3.0.1 // indirect
+	github.com/prometheus/client_golang v1.11.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.7.1
 	go.uber.org/zap v1.10.0
-	h12.io/socks v1.0.2 // indirect
+	google.golang.org/grpc v1.43.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
+	gopkg.in/yaml.v2 v2.4.0
+	h12.io/socks v1.0.2
 )
@@ -1,13 +1,114 @@
 package api
 
-import "proxy-pool/config"
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"net/http"
+	"proxy-pool/config"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/log"
+	"proxy-pool/pkg/pool"
+)
+
+// @title proxy-pool management api
+// @version 1.0
+// @description Inspect and manage the proxy pool.
+// @BasePath /
+// @securityDefinitions.apikey ApiKey
+// @in header
+// @name X-Api-Key
 
 type Server struct {
-	cfg *config.Config
+	cfg           *config.Config
+	poolService   *pool.Service
+	pacService    *pool.PacService
+	apiKeyService *auth.ApiKeyService
 }
 
-func newApiServer(cfg *config.Config) *Server {
+func newApiServer(
+	cfg *config.Config,
+	poolService *pool.Service,
+	pacService *pool.PacService,
+	apiKeyService *auth.ApiKeyService,
+) *Server {
 	return &Server{
-		cfg: cfg,
+		cfg:           cfg,
+		poolService:   poolService,
+		pacService:    pacService,
+		apiKeyService: apiKeyService,
+	}
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleIndex)
+	mux.Handle("/dashboard/", dashboardHandler())
+	mux.HandleFunc("/proxies", s.protect(s.handleProxies))
+	mux.HandleFunc("/proxies/", s.protect(s.handleProxy))
+	mux.HandleFunc("/proxies/export", s.protect(s.handleExport))
+	mux.HandleFunc("/pac/domains", s.protect(s.handlePacDomains))
+	mux.HandleFunc("/events", s.protect(s.handleEvents))
+	mux.HandleFunc("/stats", s.protect(s.handleStats))
+	mux.HandleFunc("/stats/fetchers", s.protect(s.handleFetcherStats))
+	mux.HandleFunc("/fetch", s.protect(s.handleFetch))
+	mux.HandleFunc("/metrics", s.protect(s.handleMetrics))
+	mux.HandleFunc("/keys", s.protectAdmin(s.handleKeys))
+	mux.HandleFunc("/keys/", s.protectAdmin(s.revokeKey))
+	mux.HandleFunc("/openapi.json", handleOpenApi)
+	mux.HandleFunc("/docs", handleSwaggerUi)
+	return mux
+}
+
+// Start serves the rest and grpc apis until ctx is done, then lets the requests in progress finish
+func (s *Server) Start(ctx context.Context) error {
+	// the pool size is the same from every replica, only the api reports it
+	err := prometheus.Register(pool.NewPoolCollector(s.poolService))
+	var registered prometheus.AlreadyRegisteredError
+	if err != nil && !errors.As(err, &registered) {
+		return err
 	}
-}
\ No newline at end of file
+	grpcServer := s.newGrpc()
+	httpServer := &http.Server{Addr: s.cfg.Api.Listen, Handler: s.routes()}
+	errs := make(chan error, 2)
+	go func() {
+		errs <- startGrpc(grpcServer, s.cfg.Api.GrpcListen)
+	}()
+	go func() {
+		log.Logger.Info("starting api server", zap.String("addr", s.cfg.Api.Listen))
+		errs <- httpServer.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	s.shutdown(httpServer, grpcServer)
+	return nil
+}
+
+// shutdown waits for the requests in progress up to the shutdown timeout,
+// event streams do not end on their own and are cut then
+func (s *Server) shutdown(httpServer *http.Server, grpcServer *grpc.Server) {
+	log.Logger.Info("shutting down api server", zap.Duration("timeout", s.cfg.ShutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	err := httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Logger.Warn("cutting api requests still in progress", zap.Error(err))
+		_ = httpServer.Close()
+	}
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+		<-stopped
+	}
+}
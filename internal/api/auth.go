@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/log"
+	"proxy-pool/pkg/pool"
+	"strings"
+)
+
+// anonymousKey is used for every request when authentication is disabled
+var anonymousKey = &auth.ApiKey{Name: "anonymous", Scopes: []auth.Scope{auth.ScopeAdmin}}
+
+var errUnauthorized = errors.New("missing or invalid api key")
+
+func bearerToken(header string) string {
+	if strings.HasPrefix(strings.ToLower(header), "bearer ") {
+		return strings.TrimSpace(header[len("bearer "):])
+	}
+	return ""
+}
+
+func (s *Server) verify(ctx context.Context, token string) (*auth.ApiKey, error) {
+	if s.cfg.Api.AuthDisabled {
+		return anonymousKey, nil
+	}
+	if token == "" {
+		return nil, errUnauthorized
+	}
+	key, err := s.apiKeyService.Verify(ctx, token)
+	if errors.Is(err, auth.ErrInvalidKey) {
+		return nil, errUnauthorized
+	}
+	return key, err
+}
+
+// protect requires pool:read for safe methods and pool:write for the others
+func (s *Server) protect(next http.HandlerFunc) http.HandlerFunc {
+	return s.requireScope(next, func(request *http.Request) auth.Scope {
+		if request.Method == http.MethodGet || request.Method == http.MethodHead {
+			return auth.ScopePoolRead
+		}
+		return auth.ScopePoolWrite
+	})
+}
+
+// protectAdmin requires the admin scope for every method
+func (s *Server) protectAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return s.requireScope(next, func(*http.Request) auth.Scope {
+		return auth.ScopeAdmin
+	})
+}
+
+// requireScope checks the key of the request has the scope scopeOf asks for.
+// The key is taken from the Authorization bearer header, X-Api-Key, or the api_key
+// query parameter for clients like EventSource which can not set headers
+func (s *Server) requireScope(next http.HandlerFunc, scopeOf func(*http.Request) auth.Scope) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		token := bearerToken(request.Header.Get("Authorization"))
+		if token == "" {
+			token = request.Header.Get("X-Api-Key")
+		}
+		if token == "" {
+			token = request.URL.Query().Get("api_key")
+		}
+		key, err := s.verify(request.Context(), token)
+		if errors.Is(err, errUnauthorized) {
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(writer, http.StatusUnauthorized, err)
+			return
+		}
+		if err != nil {
+			log.Logger.Error("failed to verify api key", zap.Error(err))
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		scope := scopeOf(request)
+		if !key.HasScope(scope) {
+			writeError(writer, http.StatusForbidden, errors.New("api key lacks scope "+string(scope)))
+			return
+		}
+		next(writer, request.WithContext(auth.WithKey(request.Context(), key)))
+	}
+}
+
+// redact removes upstream credentials unless the caller may read them
+func redact(ctx context.Context, proxy *pool.Proxy) *pool.Proxy {
+	if auth.HasScope(ctx, auth.ScopeCredentialsRead) {
+		return proxy
+	}
+	return proxy.WithoutCredentials()
+}
+
+// grpcScopes lists the scope each rpc requires
+var grpcScopes = map[string]auth.Scope{
+	"GetRandom":     auth.ScopePoolRead,
+	"Lease":         auth.ScopePoolWrite,
+	"Release":       auth.ScopePoolWrite,
+	"List":          auth.ScopePoolRead,
+	"Stats":         auth.ScopePoolRead,
+	"WatchEvents":   auth.ScopePoolRead,
+	"ReportFailure": auth.ScopePoolWrite,
+	"Import":        auth.ScopePoolWrite,
+}
+
+func (s *Server) authorizeGrpc(ctx context.Context, fullMethod string) (context.Context, error) {
+	token := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = bearerToken(values[0])
+		}
+	}
+	key, err := s.verify(ctx, token)
+	if errors.Is(err, errUnauthorized) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	scope, ok := grpcScopes[method]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+	if !key.HasScope(scope) {
+		return nil, status.Error(codes.PermissionDenied, "api key lacks scope "+string(scope))
+	}
+	return auth.WithKey(ctx, key), nil
+}
+
+func (s *Server) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authorizeGrpc(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a authorizedStream) Context() context.Context {
+	return a.ctx
+}
+
+func (s *Server) streamAuthInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorizeGrpc(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, authorizedStream{ServerStream: stream, ctx: ctx})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"proxy-pool/config"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/pool"
+	"testing"
+)
+
+// newTestServer serves the api from an in-memory redis and returns a token for each of scopes
+func newTestServer(t *testing.T, scopes ...auth.Scope) (*Server, map[auth.Scope]string) {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	cfg := &config.Config{}
+	events := pool.NewEventBus(client)
+	stats := pool.NewStatsService(client)
+	repository := pool.NewRepository(client)
+	checker := pool.NewCheckerService(cfg, client, events, stats)
+	expiry := pool.NewExpiryService(cfg, repository, checker, events)
+	poolService := pool.NewPoolService(repository, nil, checker, events, nil, stats, expiry, nil)
+	s := newApiServer(cfg, poolService, nil, auth.NewApiKeyService(client))
+	tokens := map[auth.Scope]string{}
+	for _, scope := range scopes {
+		_, token, err := s.apiKeyService.Create(context.Background(), string(scope), []auth.Scope{scope})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[scope] = token
+	}
+	return s, tokens
+}
+
+func TestServer_protectAdmin(t *testing.T) {
+	s, tokens := newTestServer(t, auth.ScopePoolWrite, auth.ScopeAdmin)
+	routes := s.routes()
+	tests := []struct {
+		scope auth.Scope
+		want  int
+	}{
+		{auth.ScopePoolWrite, http.StatusForbidden},
+		{auth.ScopeAdmin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scope), func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/keys", nil)
+			request.Header.Set("X-Api-Key", tokens[tt.scope])
+			recorder := httptest.NewRecorder()
+			routes.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("GET /keys = %v, want %v", recorder.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_authorizeGrpc(t *testing.T) {
+	s, tokens := newTestServer(t, auth.ScopePoolRead, auth.ScopePoolWrite)
+	tests := []struct {
+		method string
+		scope  auth.Scope
+		want   codes.Code
+	}{
+		{"GetRandom", auth.ScopePoolRead, codes.OK},
+		{"Lease", auth.ScopePoolRead, codes.PermissionDenied},
+		{"Release", auth.ScopePoolRead, codes.PermissionDenied},
+		{"Lease", auth.ScopePoolWrite, codes.OK},
+		{"Release", auth.ScopePoolWrite, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+string(tt.scope), func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+tokens[tt.scope]))
+			_, err := s.authorizeGrpc(ctx, "/proxypool.v1.PoolService/"+tt.method)
+			if status.Code(err) != tt.want {
+				t.Errorf("authorizeGrpc() = %v, want %v", status.Code(err), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/dashboard/", http.FileServer(http.FS(files)))
+}
+
+func handleIndex(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/" {
+		writeJson(writer, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+	http.Redirect(writer, request, "/dashboard/", http.StatusFound)
+}
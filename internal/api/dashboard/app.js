@@ -0,0 +1,170 @@
+(function () {
+    'use strict';
+
+    var refreshInterval = 10000;
+    var apiKeyInput = document.getElementById('api-key');
+
+    apiKeyInput.value = localStorage.getItem('apiKey') || '';
+    apiKeyInput.addEventListener('change', function () {
+        localStorage.setItem('apiKey', apiKeyInput.value.trim());
+        refresh();
+        loadProxies().catch(showError);
+    });
+
+    function request(method, url) {
+        var headers = {};
+        if (apiKeyInput.value.trim()) {
+            headers['X-Api-Key'] = apiKeyInput.value.trim();
+        }
+        return fetch(url, {method: method, headers: headers}).then(function (resp) {
+            if (!resp.ok) {
+                return resp.json().then(function (body) {
+                    throw new Error(body.error || resp.statusText);
+                });
+            }
+            return resp.status === 204 ? null : resp.json();
+        });
+    }
+
+    function cell(row, text, className) {
+        var td = document.createElement('td');
+        td.textContent = text;
+        if (className) {
+            td.className = className;
+        }
+        row.appendChild(td);
+        return td;
+    }
+
+    function fillTable(id, rows, columns) {
+        var body = document.querySelector('#' + id + ' tbody');
+        body.innerHTML = '';
+        rows.forEach(function (r) {
+            var tr = document.createElement('tr');
+            columns(r).forEach(function (c) {
+                cell(tr, c);
+            });
+            body.appendChild(tr);
+        });
+    }
+
+    function entries(m) {
+        return Object.keys(m || {}).sort(function (a, b) {
+            return m[b] - m[a];
+        }).map(function (k) {
+            return [k || 'unknown', m[k]];
+        });
+    }
+
+    function formatTime(unix) {
+        return unix ? new Date(unix * 1000).toLocaleString() : '-';
+    }
+
+    function drawHistory(history) {
+        var canvas = document.getElementById('history');
+        var ctx = canvas.getContext('2d');
+        ctx.clearRect(0, 0, canvas.width, canvas.height);
+        if (!history || history.length < 2) {
+            return;
+        }
+        var max = Math.max.apply(null, history.map(function (s) {
+            return s.size;
+        })) || 1;
+        var first = history[0].time, last = history[history.length - 1].time;
+        var pad = 20;
+        ctx.strokeStyle = '#3b82f6';
+        ctx.lineWidth = 2;
+        ctx.beginPath();
+        history.forEach(function (s, i) {
+            var x = pad + (s.time - first) / (last - first || 1) * (canvas.width - pad * 2);
+            var y = canvas.height - pad - s.size / max * (canvas.height - pad * 2);
+            if (i === 0) {
+                ctx.moveTo(x, y);
+            } else {
+                ctx.lineTo(x, y);
+            }
+        });
+        ctx.stroke();
+        ctx.fillStyle = '#777';
+        ctx.fillText(String(max), 2, pad);
+        ctx.fillText(formatTime(first), pad, canvas.height - 4);
+    }
+
+    function loadStats() {
+        return request('GET', '/stats').then(function (stats) {
+            document.getElementById('pool-size').textContent = stats.pool_size;
+            document.getElementById('queue-depth').textContent = stats.queue_depth;
+            document.getElementById('active-tunnels').textContent = stats.active_tunnels;
+            fillTable('by-type', entries(stats.by_type), function (e) {
+                return e;
+            });
+            fillTable('by-country', entries(stats.by_country), function (e) {
+                return e;
+            });
+            fillTable('fetchers', stats.fetchers || [], function (f) {
+                return [f.name, f.runs, f.failures, formatTime(f.last_run), f.last_count, f.last_duration + ' ms', (f.pass_rate * 100).toFixed(1) + '%', f.last_error || ''];
+            });
+            drawHistory(stats.history);
+        });
+    }
+
+    function proxyId(p) {
+        return p.ip.indexOf(':') >= 0 ? '[' + p.ip + ']:' + p.port : p.ip + ':' + p.port;
+    }
+
+    function button(label, onClick) {
+        var b = document.createElement('button');
+        b.textContent = label;
+        b.addEventListener('click', onClick);
+        return b;
+    }
+
+    function loadProxies() {
+        var form = document.getElementById('filter');
+        var params = new URLSearchParams(new FormData(form));
+        return request('GET', '/proxies?' + params.toString()).then(function (proxies) {
+            var body = document.querySelector('#proxies tbody');
+            body.innerHTML = '';
+            proxies.forEach(function (p) {
+                var tr = document.createElement('tr');
+                var id = proxyId(p);
+                cell(tr, p.type);
+                cell(tr, id);
+                cell(tr, p.country || '');
+                cell(tr, p.latency);
+                var actions = cell(tr, '');
+                actions.appendChild(button('Re-check', function () {
+                    request('POST', '/proxies/' + encodeURIComponent(id) + '/check').catch(showError);
+                }));
+                actions.appendChild(button('Delete', function () {
+                    if (confirm('Delete ' + id + '?')) {
+                        request('DELETE', '/proxies/' + encodeURIComponent(id)).then(loadProxies).catch(showError);
+                    }
+                }));
+                body.appendChild(tr);
+            });
+        });
+    }
+
+    function showError(err) {
+        alert(err.message);
+    }
+
+    document.getElementById('fetch').addEventListener('click', function () {
+        request('POST', '/fetch').catch(showError);
+    });
+    document.getElementById('filter').addEventListener('submit', function (e) {
+        e.preventDefault();
+        loadProxies().catch(showError);
+    });
+
+    function refresh() {
+        loadStats().catch(function (err) {
+            console.error(err);
+        });
+    }
+
+    refresh();
+    loadProxies().catch(showError);
+    setInterval(refresh, refreshInterval);
+})();
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"proxy-pool/pkg/pool"
+	"strings"
+	"time"
+)
+
+const eventKeepAliveInterval = time.Second * 15
+
+// handleEvents godoc
+// @Summary Stream pool events
+// @Description Server-sent events, one per pool change, the event name is the event type
+// @Tags events
+// @Produce text/event-stream
+// @Param type query string false "comma separated event types to stream"
+// @Param api_key query string false "api key, for clients which can not set headers"
+// @Success 200 {object} pool.Event
+// @Security ApiKey
+// @Router /events [get]
+func (s *Server) handleEvents(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	types := map[pool.EventType]bool{}
+	if t := request.URL.Query().Get("type"); t != "" {
+		for _, v := range strings.Split(t, ",") {
+			types[pool.EventType(strings.TrimSpace(v))] = true
+		}
+	}
+
+	ctx := request.Context()
+	events := s.poolService.Subscribe(ctx)
+
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := fmt.Fprint(writer, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+			event.Proxy = redact(ctx, event.Proxy)
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			_, err = fmt.Fprintf(writer, "event: %v\ndata: %s\n\n", event.Type, data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
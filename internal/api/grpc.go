@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"proxy-pool/pkg/log"
+	"proxy-pool/pkg/pool"
+	"proxy-pool/pkg/poolpb"
+)
+
+// grpcServer exposes the same pool service as the rest api
+type grpcServer struct {
+	poolpb.UnimplementedPoolServiceServer
+	poolService *pool.Service
+}
+
+func (s *Server) newGrpc() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuthInterceptor),
+		grpc.StreamInterceptor(s.streamAuthInterceptor),
+	)
+	poolpb.RegisterPoolServiceServer(server, &grpcServer{poolService: s.poolService})
+	return server
+}
+
+func startGrpc(server *grpc.Server, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Logger.Info("starting grpc server", zap.String("addr", addr))
+	return server.Serve(listener)
+}
+
+func toStatusError(err error) error {
+	switch {
+	case errors.Is(err, pool.ErrNotFound), errors.Is(err, pool.ErrLeaseNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, pool.ErrNoProxyAvailable), errors.Is(err, pool.ErrEmptyPool):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, pool.ErrInvalidProxy):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func fromPbFilter(f *poolpb.Filter) (pool.Filter, error) {
+	filter := pool.Filter{
+		Country: f.GetCountry(),
+		Limit:   int(f.GetLimit()),
+	}
+	if f.GetType() != "" {
+		t, err := pool.ParseType(f.GetType())
+		if err != nil {
+			return filter, status.Error(codes.InvalidArgument, err.Error())
+		}
+		filter.Type = t
+	}
+	return filter, nil
+}
+
+func toPbProxy(p *pool.Proxy) *poolpb.Proxy {
+	if p == nil {
+		return nil
+	}
+	return &poolpb.Proxy{
+		Ip:               p.Ip,
+		Port:             int32(p.Port),
+		Type:             string(p.Type),
+		Country:          p.Country,
+		Latency:          int32(p.Latency),
+		Username:         p.Username,
+		Password:         p.Password,
+		Source:           p.Source,
+		Sources:          p.Sources,
+		FirstSeen:        toPbTime(p.FirstSeen),
+		LastSeenInSource: toPbTime(p.LastSeenInSource),
+		LastChecked:      toPbTime(p.LastChecked),
+		LastUsed:         toPbTime(p.LastUsed),
+		Sessions:         int32(p.Sessions),
+		Countries:        p.Countries,
+	}
+}
+
+// toPbTime converts a unix time, 0 stands for unknown
+func toPbTime(unix int64) *timestamppb.Timestamp {
+	if unix <= 0 {
+		return nil
+	}
+	return &timestamppb.Timestamp{Seconds: unix}
+}
+
+func fromPbProxy(p *poolpb.Proxy) *pool.Proxy {
+	return &pool.Proxy{
+		Ip:       p.GetIp(),
+		Port:     int(p.GetPort()),
+		Type:     pool.Type(p.GetType()),
+		Country:  p.GetCountry(),
+		Latency:  int(p.GetLatency()),
+		Username: p.GetUsername(),
+		Password: p.GetPassword(),
+	}
+}
+
+func (g *grpcServer) GetRandom(ctx context.Context, req *poolpb.GetRandomRequest) (*poolpb.ProxyList, error) {
+	filter, err := fromPbFilter(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+	count := int(req.GetCount())
+	if count <= 0 {
+		count = 1
+	}
+	entities, err := g.poolService.GetRandom(ctx, count, filter)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	list := &poolpb.ProxyList{}
+	for _, e := range entities {
+		list.Proxies = append(list.Proxies, toPbProxy(redact(ctx, e.ToProxy())))
+	}
+	return list, nil
+}
+
+func (g *grpcServer) Lease(ctx context.Context, req *poolpb.LeaseRequest) (*poolpb.LeaseResponse, error) {
+	filter, err := fromPbFilter(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+	lease, err := g.poolService.Lease(ctx, filter, req.GetTtl().AsDuration())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &poolpb.LeaseResponse{
+		LeaseId:   lease.Id,
+		Proxy:     toPbProxy(redact(ctx, lease.Proxy)),
+		ExpiresAt: timestamppb.New(lease.ExpiresAt),
+	}, nil
+}
+
+func (g *grpcServer) Release(ctx context.Context, req *poolpb.ReleaseRequest) (*poolpb.ReleaseResponse, error) {
+	err := g.poolService.Release(ctx, req.GetLeaseId())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &poolpb.ReleaseResponse{}, nil
+}
+
+func (g *grpcServer) ReportFailure(ctx context.Context, req *poolpb.ReportFailureRequest) (*poolpb.ReportFailureResponse, error) {
+	err := g.poolService.ReportFailure(ctx, req.GetIp(), int(req.GetPort()), req.GetReason())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &poolpb.ReportFailureResponse{}, nil
+}
+
+func (g *grpcServer) Import(ctx context.Context, req *poolpb.ImportRequest) (*poolpb.ImportResponse, error) {
+	proxies := make([]*pool.Proxy, 0, len(req.GetProxies()))
+	for _, p := range req.GetProxies() {
+		proxies = append(proxies, fromPbProxy(p))
+	}
+	imported, err := g.poolService.Import(ctx, proxies, req.GetSkipCheck())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &poolpb.ImportResponse{Imported: int32(imported)}, nil
+}
+
+func (g *grpcServer) List(ctx context.Context, req *poolpb.ListRequest) (*poolpb.ProxyList, error) {
+	filter, err := fromPbFilter(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+	entities, err := g.poolService.List(ctx, filter)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	list := &poolpb.ProxyList{}
+	for _, e := range entities {
+		list.Proxies = append(list.Proxies, toPbProxy(redact(ctx, e.ToProxy())))
+	}
+	return list, nil
+}
+
+func (g *grpcServer) Stats(ctx context.Context, _ *poolpb.StatsRequest) (*poolpb.StatsResponse, error) {
+	stats, err := g.poolService.Stats(ctx)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp := &poolpb.StatsResponse{
+		PoolSize:      int32(stats.PoolSize),
+		ByType:        map[string]int32{},
+		ByCountry:     map[string]int32{},
+		QueueDepth:    stats.QueueDepth,
+		ActiveTunnels: stats.ActiveTunnels,
+	}
+	for t, c := range stats.ByType {
+		resp.ByType[string(t)] = int32(c)
+	}
+	for country, c := range stats.ByCountry {
+		resp.ByCountry[country] = int32(c)
+	}
+	for _, f := range stats.Fetchers {
+		fetcher := &poolpb.FetcherStats{
+			Name:       f.Name,
+			Runs:       f.Runs,
+			Failures:   f.Failures,
+			LastCount:  f.LastCount,
+			LastError:  f.LastError,
+			Fetched:    f.Fetched,
+			Duplicates: f.Duplicates,
+			Enqueued:   f.Enqueued,
+			Passed:     f.Passed,
+			Failed:     f.Failed,
+			PassRate:   f.PassRate,
+		}
+		fetcher.LastRun = toPbTime(f.LastRun)
+		resp.Fetchers = append(resp.Fetchers, fetcher)
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) WatchEvents(req *poolpb.WatchEventsRequest, stream poolpb.PoolService_WatchEventsServer) error {
+	types := map[pool.EventType]bool{}
+	for _, t := range req.GetTypes() {
+		types[pool.EventType(t)] = true
+	}
+	ctx := stream.Context()
+	for event := range g.poolService.Subscribe(ctx) {
+		if len(types) > 0 && !types[event.Type] {
+			continue
+		}
+		err := stream.Send(&poolpb.Event{
+			Type:    string(event.Type),
+			Time:    timestamppb.New(event.Time),
+			Proxy:   toPbProxy(redact(ctx, event.Proxy)),
+			Fetcher: event.Fetcher,
+			Count:   int32(event.Count),
+			Reason:  event.Reason,
+			Error:   event.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/poolpb"
+	"testing"
+)
+
+// newTestGrpcClient serves the grpc api of s and returns a client authenticated with token
+func newTestGrpcClient(t *testing.T, s *Server, token string) (poolpb.PoolServiceClient, context.Context) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := s.newGrpc()
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	return poolpb.NewPoolServiceClient(conn), ctx
+}
+
+func TestGrpcServer(t *testing.T) {
+	s, _ := newTestServer(t)
+	_, token, err := s.apiKeyService.Create(context.Background(), "client", []auth.Scope{auth.ScopePoolRead, auth.ScopePoolWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, ctx := newTestGrpcClient(t, s, token)
+
+	imported, err := client.Import(ctx, &poolpb.ImportRequest{
+		Proxies: []*poolpb.Proxy{
+			{Ip: "10.0.0.1", Port: 80, Type: "http", Username: "user", Password: "secret"},
+			{Ip: "10.0.0.2", Port: 80, Type: "http"},
+		},
+		SkipCheck: true,
+	})
+	if err != nil || imported.GetImported() != 2 {
+		t.Fatalf("Import() = %v %v, want 2", imported.GetImported(), err)
+	}
+
+	lease, err := client.Lease(ctx, &poolpb.LeaseRequest{})
+	if err != nil {
+		t.Fatalf("Lease() error = %v", err)
+	}
+	random, err := client.GetRandom(ctx, &poolpb.GetRandomRequest{Count: 2})
+	if err != nil {
+		t.Fatalf("GetRandom() error = %v", err)
+	}
+	if len(random.GetProxies()) != 1 || random.GetProxies()[0].GetIp() == lease.GetProxy().GetIp() {
+		t.Errorf("GetRandom() = %v, want only the proxy which is not leased", random.GetProxies())
+	}
+	for _, p := range random.GetProxies() {
+		if p.GetPassword() != "" {
+			t.Error("GetRandom() returned credentials without credentials:read")
+		}
+	}
+	_, err = client.Release(ctx, &poolpb.ReleaseRequest{LeaseId: lease.GetLeaseId()})
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	_, err = client.Release(ctx, &poolpb.ReleaseRequest{LeaseId: lease.GetLeaseId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Release() twice = %v, want %v", status.Code(err), codes.NotFound)
+	}
+
+	_, err = client.ReportFailure(ctx, &poolpb.ReportFailureRequest{Ip: "10.0.0.1", Port: 80})
+	if err != nil {
+		t.Fatalf("ReportFailure() error = %v", err)
+	}
+	list, err := client.List(ctx, &poolpb.ListRequest{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list.GetProxies()) != 1 || list.GetProxies()[0].GetIp() != "10.0.0.2" {
+		t.Errorf("List() after ReportFailure() = %v, want only 10.0.0.2", list.GetProxies())
+	}
+	_, err = client.ReportFailure(ctx, &poolpb.ReportFailureRequest{Ip: "10.0.0.1", Port: 80})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ReportFailure() of a removed proxy = %v, want %v", status.Code(err), codes.NotFound)
+	}
+}
@@ -5,8 +5,10 @@ package api
 import (
 	"github.com/google/wire"
 	"proxy-pool/internal/core"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/pool"
 )
 
-func NewApiServer() *Server {
-	panic(wire.Build(core.Set, newApiServer))
-}
\ No newline at end of file
+func NewApiServer() (*Server, func()) {
+	panic(wire.Build(core.Set, pool.Set, auth.Set, newApiServer))
+}
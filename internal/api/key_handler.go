@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"proxy-pool/pkg/auth"
+	"strings"
+)
+
+type createKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type createKeyResponse struct {
+	Key *auth.ApiKey `json:"key"`
+	// shown only once, only its hash is stored
+	Token string `json:"token"`
+}
+
+// handleKeys routes /keys, key management requires the admin scope
+func (s *Server) handleKeys(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if request.Method == http.MethodPost {
+		s.createKey(writer, request)
+		return
+	}
+	s.listKeys(writer, request)
+}
+
+// listKeys godoc
+// @Summary List api keys
+// @Description The tokens are not stored and not listed. Requires the admin scope
+// @Tags keys
+// @Produce json
+// @Success 200 {array} auth.ApiKey
+// @Security ApiKey
+// @Router /keys [get]
+func (s *Server) listKeys(writer http.ResponseWriter, request *http.Request) {
+	keys, err := s.apiKeyService.List(request.Context())
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(writer, http.StatusOK, keys)
+}
+
+// createKey godoc
+// @Summary Create an api key
+// @Description The token of the key is only returned by this request. Requires the admin scope
+// @Tags keys
+// @Accept json
+// @Produce json
+// @Param key body createKeyRequest true "name and scopes of the key"
+// @Success 201 {object} createKeyResponse
+// @Failure 400 {object} errorResponse
+// @Security ApiKey
+// @Router /keys [post]
+func (s *Server) createKey(writer http.ResponseWriter, request *http.Request) {
+	var body createKeyRequest
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	scopes := make([]auth.Scope, 0, len(body.Scopes))
+	for _, s := range body.Scopes {
+		scope, err := auth.ParseScope(s)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+	key, token, err := s.apiKeyService.Create(request.Context(), body.Name, scopes)
+	if errors.Is(err, auth.ErrNoScope) {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(writer, http.StatusCreated, createKeyResponse{Key: key, Token: token})
+}
+
+// revokeKey godoc
+// @Summary Revoke an api key
+// @Description Requires the admin scope
+// @Tags keys
+// @Param id path string true "key id"
+// @Success 204
+// @Failure 404 {object} errorResponse
+// @Security ApiKey
+// @Router /keys/{id} [delete]
+func (s *Server) revokeKey(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodDelete) {
+		return
+	}
+	err := s.apiKeyService.Revoke(request.Context(), strings.TrimPrefix(request.URL.Path, "/keys/"))
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		writeError(writer, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
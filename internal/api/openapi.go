@@ -0,0 +1,76 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"net/http"
+	"sync"
+)
+
+// swagger.json is generated from the handler annotations by `make docs`
+//go:embed docs/swagger.json
+var swaggerSpec []byte
+
+var (
+	openApiOnce sync.Once
+	openApiSpec []byte
+	openApiErr  error
+)
+
+// openApiDocument converts the generated swagger 2.0 spec to openapi 3
+func openApiDocument() ([]byte, error) {
+	openApiOnce.Do(func() {
+		var v2 openapi2.T
+		openApiErr = json.Unmarshal(swaggerSpec, &v2)
+		if openApiErr != nil {
+			return
+		}
+		v3, err := openapi2conv.ToV3(&v2)
+		if err != nil {
+			openApiErr = err
+			return
+		}
+		openApiSpec, openApiErr = json.Marshal(v3)
+	})
+	return openApiSpec, openApiErr
+}
+
+func handleOpenApi(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	spec, err := openApiDocument()
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write(spec)
+}
+
+const swaggerUiPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>proxy-pool api</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@4/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@4/swagger-ui-bundle.js"></script>
+<script>
+    window.ui = SwaggerUIBundle({url: '/openapi.json', dom_id: '#swagger-ui'});
+</script>
+</body>
+</html>
+`
+
+func handleSwaggerUi(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = writer.Write([]byte(swaggerUiPage))
+}
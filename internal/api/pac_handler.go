@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"proxy-pool/pkg/pool"
+)
+
+type pacDomainRequest struct {
+	Domain string `json:"domain" example:"*.example.com"`
+}
+
+type pacDomainsResponse struct {
+	Domains []string `json:"domains"`
+}
+
+func (s *Server) handlePacDomains(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	switch request.Method {
+	case http.MethodPost:
+		s.addPacDomain(writer, request)
+	case http.MethodDelete:
+		s.removePacDomain(writer, request)
+	default:
+		s.listPacDomains(writer, request)
+	}
+}
+
+// listPacDomains godoc
+// @Summary List the domain patterns routed through the pool by proxy.pac
+// @Tags pac
+// @Produce json
+// @Success 200 {object} pacDomainsResponse
+// @Security ApiKey
+// @Router /pac/domains [get]
+func (s *Server) listPacDomains(writer http.ResponseWriter, request *http.Request) {
+	domains, err := s.pacService.Domains(request.Context())
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	if domains == nil {
+		domains = []string{}
+	}
+	writeJson(writer, http.StatusOK, pacDomainsResponse{Domains: domains})
+}
+
+// addPacDomain godoc
+// @Summary Route a domain pattern through the pool
+// @Tags pac
+// @Accept json
+// @Produce json
+// @Param body body pacDomainRequest true "domain pattern"
+// @Success 200 {object} pacDomainsResponse
+// @Failure 400 {object} errorResponse
+// @Security ApiKey
+// @Router /pac/domains [post]
+func (s *Server) addPacDomain(writer http.ResponseWriter, request *http.Request) {
+	var body pacDomainRequest
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	err = s.pacService.AddDomain(request.Context(), body.Domain)
+	if err != nil {
+		writeDomainError(writer, err)
+		return
+	}
+	s.listPacDomains(writer, request)
+}
+
+// removePacDomain godoc
+// @Summary Stop routing a domain pattern through the pool
+// @Description Patterns from the config file can not be removed
+// @Tags pac
+// @Produce json
+// @Param domain query string true "domain pattern"
+// @Success 200 {object} pacDomainsResponse
+// @Failure 400 {object} errorResponse
+// @Security ApiKey
+// @Router /pac/domains [delete]
+func (s *Server) removePacDomain(writer http.ResponseWriter, request *http.Request) {
+	err := s.pacService.RemoveDomain(request.Context(), request.URL.Query().Get("domain"))
+	if err != nil {
+		writeDomainError(writer, err)
+		return
+	}
+	s.listPacDomains(writer, request)
+}
+
+func writeDomainError(writer http.ResponseWriter, err error) {
+	if errors.Is(err, pool.ErrInvalidDomain) {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	writeError(writer, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/pool"
+	"strconv"
+	"strings"
+)
+
+func parseFilter(request *http.Request) (pool.Filter, error) {
+	query := request.URL.Query()
+	filter := pool.Filter{
+		Country: query.Get("country"),
+	}
+	if t := query.Get("type"); t != "" {
+		parsed, err := pool.ParseType(t)
+		if err != nil {
+			return filter, err
+		}
+		filter.Type = parsed
+	}
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			return filter, errors.New("invalid limit " + l)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// handleExport godoc
+// @Summary Export the pool
+// @Description Export the pool as plain text, json, csv, a clash proxies block, a proxychains config or a pac file
+// @Tags proxies
+// @Produce plain,json,text/csv,application/x-yaml,application/x-ns-proxy-autoconfig
+// @Param format query string false "output format" Enums(text, json, csv, clash, proxychains, pac)
+// @Param type query string false "proxy type" Enums(http, https, socks4, socks5)
+// @Param country query string false "country"
+// @Param limit query int false "maximum number of proxies"
+// @Success 200 {string} string
+// @Failure 400 {object} errorResponse
+// @Security ApiKey
+// @Router /proxies/export [get]
+func (s *Server) handleExport(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	format, err := pool.ParseFormat(request.URL.Query().Get("format"))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	filter, err := parseFilter(request)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	entities, err := s.poolService.Exits(request.Context(), filter)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	if !auth.HasScope(request.Context(), auth.ScopeCredentialsRead) {
+		entities = pool.WithoutCredentials(entities)
+	}
+	writer.Header().Set("Content-Type", format.ContentType())
+	_ = pool.Export(writer, format, entities)
+}
+
+// handleProxies godoc
+// @Summary List proxies
+// @Tags proxies
+// @Produce json
+// @Param type query string false "proxy type" Enums(http, https, socks4, socks5)
+// @Param country query string false "country"
+// @Param limit query int false "maximum number of proxies"
+// @Success 200 {array} pool.Proxy
+// @Failure 400 {object} errorResponse
+// @Security ApiKey
+// @Router /proxies [get]
+func (s *Server) handleProxies(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	filter, err := parseFilter(request)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	entities, err := s.poolService.List(request.Context(), filter)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	proxies := make([]*pool.Proxy, 0, len(entities))
+	for _, e := range entities {
+		proxies = append(proxies, redact(request.Context(), e.ToProxy()))
+	}
+	writeJson(writer, http.StatusOK, proxies)
+}
+
+// handleProxy routes /proxies/{id} and /proxies/{id}/check where id is ip:port
+func (s *Server) handleProxy(writer http.ResponseWriter, request *http.Request) {
+	path := strings.TrimPrefix(request.URL.Path, "/proxies/")
+	if strings.HasSuffix(path, "/check") {
+		if allowMethods(writer, request, http.MethodPost) {
+			s.recheckProxy(writer, request, strings.TrimSuffix(path, "/check"))
+		}
+		return
+	}
+	if !allowMethods(writer, request, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	if request.Method == http.MethodDelete {
+		s.deleteProxy(writer, request, path)
+		return
+	}
+	s.getProxy(writer, request, path)
+}
+
+// findProxy loads the proxy identified by ip:port, it writes the error response when it fails
+func (s *Server) findProxy(writer http.ResponseWriter, request *http.Request, id string) (*pool.Proxy, bool) {
+	host, p, err := net.SplitHostPort(id)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, pool.ErrNotFound)
+		return nil, false
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, pool.ErrNotFound)
+		return nil, false
+	}
+	e, err := s.poolService.Get(request.Context(), host, port)
+	if errors.Is(err, pool.ErrNotFound) {
+		writeError(writer, http.StatusNotFound, err)
+		return nil, false
+	}
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return e.ToProxy(), true
+}
+
+// getProxy godoc
+// @Summary Get a proxy
+// @Tags proxies
+// @Produce json
+// @Param id path string true "proxy address as ip:port"
+// @Success 200 {object} pool.Proxy
+// @Failure 404 {object} errorResponse
+// @Security ApiKey
+// @Router /proxies/{id} [get]
+func (s *Server) getProxy(writer http.ResponseWriter, request *http.Request, id string) {
+	proxy, ok := s.findProxy(writer, request, id)
+	if !ok {
+		return
+	}
+	writeJson(writer, http.StatusOK, redact(request.Context(), proxy))
+}
+
+// deleteProxy godoc
+// @Summary Remove a proxy from the pool
+// @Tags proxies
+// @Param id path string true "proxy address as ip:port"
+// @Success 204
+// @Failure 404 {object} errorResponse
+// @Security ApiKey
+// @Router /proxies/{id} [delete]
+func (s *Server) deleteProxy(writer http.ResponseWriter, request *http.Request, id string) {
+	proxy, ok := s.findProxy(writer, request, id)
+	if !ok {
+		return
+	}
+	err := s.poolService.DeleteProxy(request.Context(), proxy, pool.ReasonManual)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// recheckProxy godoc
+// @Summary Queue a proxy to be checked again
+// @Tags proxies
+// @Produce json
+// @Param id path string true "proxy address as ip:port"
+// @Success 202 {object} pool.Proxy
+// @Failure 404 {object} errorResponse
+// @Security ApiKey
+// @Router /proxies/{id}/check [post]
+func (s *Server) recheckProxy(writer http.ResponseWriter, request *http.Request, id string) {
+	proxy, ok := s.findProxy(writer, request, id)
+	if !ok {
+		return
+	}
+	err := s.poolService.RecheckProxy(request.Context(), proxy)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(writer, http.StatusAccepted, redact(request.Context(), proxy))
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"proxy-pool/pkg/log"
+	"strings"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJson(writer http.ResponseWriter, status int, v interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	err := json.NewEncoder(writer).Encode(v)
+	if err != nil {
+		log.Logger.Warn("failed to write response", zap.Error(err))
+	}
+}
+
+func writeError(writer http.ResponseWriter, status int, err error) {
+	writeJson(writer, status, errorResponse{Error: err.Error()})
+}
+
+func allowMethods(writer http.ResponseWriter, request *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if request.Method == m {
+			return true
+		}
+	}
+	writer.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJson(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	return false
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"proxy-pool/pkg/metrics"
+)
+
+type fetchResponse struct {
+	Status string `json:"status"`
+}
+
+// handleStats godoc
+// @Summary Pool statistics
+// @Description Pool size by type and country, checker queue depth, active tunnels, fetcher runs and pool size history
+// @Tags stats
+// @Produce json
+// @Success 200 {object} pool.Stats
+// @Security ApiKey
+// @Router /stats [get]
+func (s *Server) handleStats(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	stats, err := s.poolService.Stats(request.Context())
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(writer, http.StatusOK, stats)
+}
+
+// handleFetcherStats godoc
+// @Summary Fetcher statistics ranked by source quality
+// @Description Totals of fetched, duplicate, enqueued, passed and failed proxies per fetcher, the best pass rate first
+// @Tags stats
+// @Produce json
+// @Success 200 {array} pool.FetcherStats
+// @Security ApiKey
+// @Router /stats/fetchers [get]
+func (s *Server) handleFetcherStats(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	stats, err := s.poolService.FetcherStats(request.Context())
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(writer, http.StatusOK, stats)
+}
+
+// handleFetch godoc
+// @Summary Run every fetcher once
+// @Description The leading fetcher worker runs the fetchers, requests made before it starts share one run. The fetched proxies go through the checker queue before joining the pool
+// @Tags fetchers
+// @Produce json
+// @Success 202 {object} fetchResponse
+// @Security ApiKey
+// @Router /fetch [post]
+func (s *Server) handleFetch(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+	err := s.poolService.Fetch(request.Context())
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(writer, http.StatusAccepted, fetchResponse{Status: "requested"})
+}
+
+// handleMetrics godoc
+// @Summary Prometheus metrics
+// @Description Pool size, checker queue depth, checks, fetcher runs and the tunnels of this process in the prometheus text format
+// @Tags stats
+// @Produce plain
+// @Success 200 {string} string
+// @Security ApiKey
+// @Router /metrics [get]
+func (s *Server) handleMetrics(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	metrics.Handler().ServeHTTP(writer, request)
+}
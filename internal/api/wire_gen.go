@@ -7,12 +7,32 @@ package api
 
 import (
 	"proxy-pool/internal/core"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/pool"
+)
+
+import (
+	_ "embed"
 )
 
 // Injectors from injector.go:
 
-func NewApiServer() *Server {
+func NewApiServer() (*Server, func()) {
 	config := core.ProvideConfig()
-	server := newApiServer(config)
-	return server
+	client, cleanup := core.ProvideRedisClient(config)
+	repository := pool.NewRepository(client)
+	eventBus := pool.NewEventBus(client)
+	statsService := pool.NewStatsService(client)
+	checkerService := pool.NewCheckerService(config, client, eventBus, statsService)
+	fetcherJob := pool.NewFetcherJob(config, repository, checkerService, eventBus, statsService)
+	alertService := pool.NewAlertService(config, repository, eventBus)
+	expiryService := pool.NewExpiryService(config, repository, checkerService, eventBus)
+	leaderElection := pool.NewLeaderElection(config, client)
+	service := pool.NewPoolService(repository, fetcherJob, checkerService, eventBus, alertService, statsService, expiryService, leaderElection)
+	pacService := pool.NewPacService(config, client)
+	apiKeyService := auth.NewApiKeyService(client)
+	server := newApiServer(config, service, pacService, apiKeyService)
+	return server, func() {
+		cleanup()
+	}
 }
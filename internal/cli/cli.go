@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"proxy-pool/config"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/pool"
+)
+
+// Cli runs one-shot operations against the pool from the command line
+type Cli struct {
+	cfg           *config.Config
+	poolService   *pool.Service
+	apiKeyService *auth.ApiKeyService
+}
+
+func newCli(cfg *config.Config, poolService *pool.Service, apiKeyService *auth.ApiKeyService) *Cli {
+	return &Cli{
+		cfg:           cfg,
+		poolService:   poolService,
+		apiKeyService: apiKeyService,
+	}
+}
+
+// Fetch runs the named source, or every fetcher when source is empty, and returns once the runs finished
+func (c *Cli) Fetch(source string) ([]pool.FetchResult, error) {
+	return c.poolService.FetchNow(source)
+}
+
+// Check probes the proxy given as uri, host:port or host:port:user:pass
+func (c *Cli) Check(ctx context.Context, uri string) (pool.CheckResult, error) {
+	proxy, err := pool.ParseProxy(uri, pool.Http)
+	if err != nil {
+		return pool.CheckResult{}, err
+	}
+	return c.poolService.CheckProxy(ctx, proxy)
+}
+
+func (c *Cli) List(ctx context.Context, filter pool.Filter) ([]*pool.Proxy, error) {
+	entities, err := c.poolService.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	proxies := make([]*pool.Proxy, 0, len(entities))
+	for _, e := range entities {
+		proxies = append(proxies, e.ToProxy())
+	}
+	return proxies, nil
+}
+
+// Delete removes the proxy at the address of uri from the pool
+func (c *Cli) Delete(ctx context.Context, uri string) error {
+	proxy, err := pool.ParseProxy(uri, pool.Http)
+	if err != nil {
+		return err
+	}
+	e, err := c.poolService.Get(ctx, proxy.Ip, proxy.Port)
+	if err != nil {
+		return err
+	}
+	return c.poolService.Delete(ctx, e, pool.ReasonManual)
+}
+
+func (c *Cli) Export(ctx context.Context, w io.Writer, format pool.Format, filter pool.Filter) error {
+	return c.poolService.Export(ctx, w, format, filter)
+}
+
+// CreateApiKey returns the new key and its token, the token is shown only once
+func (c *Cli) CreateApiKey(ctx context.Context, name string, scopes []auth.Scope) (*auth.ApiKey, string, error) {
+	return c.apiKeyService.Create(ctx, name, scopes)
+}
+
+func (c *Cli) RevokeApiKey(ctx context.Context, id string) error {
+	return c.apiKeyService.Revoke(ctx, id)
+}
+
+func (c *Cli) ListApiKeys(ctx context.Context) ([]*auth.ApiKey, error) {
+	return c.apiKeyService.List(ctx)
+}
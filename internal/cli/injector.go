@@ -0,0 +1,14 @@
+//+build wireinject
+
+package cli
+
+import (
+	"github.com/google/wire"
+	"proxy-pool/internal/core"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/pool"
+)
+
+func NewCli() (*Cli, func()) {
+	panic(wire.Build(core.Set, pool.Set, auth.Set, newCli))
+}
@@ -0,0 +1,33 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run github.com/google/wire/cmd/wire
+//+build !wireinject
+
+package cli
+
+import (
+	"proxy-pool/internal/core"
+	"proxy-pool/pkg/auth"
+	"proxy-pool/pkg/pool"
+)
+
+// Injectors from injector.go:
+
+func NewCli() (*Cli, func()) {
+	config := core.ProvideConfig()
+	client, cleanup := core.ProvideRedisClient(config)
+	repository := pool.NewRepository(client)
+	eventBus := pool.NewEventBus(client)
+	statsService := pool.NewStatsService(client)
+	checkerService := pool.NewCheckerService(config, client, eventBus, statsService)
+	fetcherJob := pool.NewFetcherJob(config, repository, checkerService, eventBus, statsService)
+	alertService := pool.NewAlertService(config, repository, eventBus)
+	expiryService := pool.NewExpiryService(config, repository, checkerService, eventBus)
+	leaderElection := pool.NewLeaderElection(config, client)
+	service := pool.NewPoolService(repository, fetcherJob, checkerService, eventBus, alertService, statsService, expiryService, leaderElection)
+	apiKeyService := auth.NewApiKeyService(client)
+	cli := newCli(config, service, apiKeyService)
+	return cli, func() {
+		cleanup()
+	}
+}
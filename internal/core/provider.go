@@ -1,25 +1,81 @@
 package core
 
 import (
+	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/wire"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 	"proxy-pool/config"
+	"proxy-pool/pkg/log"
 )
 
 func ProvideConfig() *config.Config {
-	var cfg *config.Config
-	_ = viper.Unmarshal(&cfg)
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Logger.Error("failed to load config", zap.Error(err))
+	}
 	return cfg
 }
 
+// LoadConfig decodes the config viper has read, with the sources of the sources file
+func LoadConfig() (*config.Config, error) {
+	return LoadConfigFrom(viper.GetViper())
+}
+
+// LoadConfigFrom is LoadConfig for another instance than the global viper
+func LoadConfigFrom(v *viper.Viper) (*config.Config, error) {
+	cfg := &config.Config{}
+	err := v.Unmarshal(cfg)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.SourcesFile != "" {
+		err = loadSources(cfg)
+	}
+	return cfg, err
+}
+
+// loadSources adds the sources and fetcher settings of their own yaml file to the ones of the main config
+func loadSources(cfg *config.Config) error {
+	v := viper.New()
+	v.SetConfigFile(cfg.SourcesFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		return fmt.Errorf("sources file %v: %w", cfg.SourcesFile, err)
+	}
+	var fetchers []config.FetcherConfig
+	var sources []config.SourceConfig
+	err = v.UnmarshalKey("fetchers", &fetchers)
+	if err == nil {
+		err = v.UnmarshalKey("sources", &sources)
+	}
+	if err != nil {
+		return fmt.Errorf("sources file %v: %w", cfg.SourcesFile, err)
+	}
+	cfg.Fetchers = append(cfg.Fetchers, fetchers...)
+	cfg.Sources = append(cfg.Sources, sources...)
+	return nil
+}
+
+// ProvideRedisClient closes the client once the injected object is cleaned up
+func ProvideRedisClient(config *config.Config) (*redis.Client, func()) {
+	rdb := ProvideRedis(config)
+	return rdb, func() {
+		err := rdb.Close()
+		if err != nil {
+			log.Logger.Warn("failed to close redis", zap.Error(err))
+		}
+	}
+}
+
 func ProvideRedis(config *config.Config) *redis.Client {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     config.RedisAddr,
-		Password: config.RedisPassword, // no password set
-		DB:       config.RedisDb,       // use default DB
+		Addr:     config.Redis.Addr,
+		Password: config.Redis.Password, // no password set
+		DB:       config.Redis.Db,       // use default DB
 	})
 	return rdb
 }
 
-var Set = wire.NewSet(ProvideConfig, ProvideRedis)
\ No newline at end of file
+var Set = wire.NewSet(ProvideConfig, ProvideRedisClient)
\ No newline at end of file
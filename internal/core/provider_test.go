@@ -0,0 +1,62 @@
+package core
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"proxy-pool/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFrom(t *testing.T) {
+	dir := t.TempDir()
+	sources := filepath.Join(dir, "sources.yaml")
+	err := os.WriteFile(sources, []byte(`
+fetchers:
+  - name: proxyscan
+    schedule: "@every 5m"
+sources:
+  - name: vendor
+    parser: file
+    paths: ["/data/*.txt"]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	config.SetDefaults(v)
+	v.SetConfigType("yaml")
+	err = v.ReadConfig(strings.NewReader(`
+proxy:
+  max_tries: 3
+checker:
+  timeout: 5s
+fetchers:
+  - name: proxyhub
+sources_file: ` + sources))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFrom(v)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() error = %v", err)
+	}
+	if cfg.Proxy.MaxTries != 3 || cfg.Checker.Timeout != time.Second*5 || cfg.Api.Listen != ":3002" {
+		t.Errorf("LoadConfigFrom() = %+v, want the file over the defaults", cfg)
+	}
+	if len(cfg.Fetchers) != 2 || cfg.Fetchers[0].Name != "proxyhub" || cfg.Fetchers[1].Schedule != "@every 5m" {
+		t.Errorf("fetchers = %+v, want the ones of both files", cfg.Fetchers)
+	}
+	if len(cfg.Sources) != 1 || cfg.Sources[0].Name != "vendor" || cfg.Sources[0].Paths[0] != "/data/*.txt" {
+		t.Errorf("sources = %+v, want the one of the sources file", cfg.Sources)
+	}
+
+	v.Set("sources_file", filepath.Join(dir, "missing.yaml"))
+	_, err = LoadConfigFrom(v)
+	if err == nil {
+		t.Error("LoadConfigFrom() accepted a missing sources file")
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"net/http"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"strings"
+	"time"
+)
+
+// reasons a tunnel ended for
+const (
+	closeClientClosed   = "client_closed"
+	closeUpstreamClosed = "upstream_closed"
+	closeDialFailed     = "dial_failed"
+	closeShutdown       = "shutdown"
+)
+
+// newAccessLog writes the records to the application log, or as json lines
+// to a file rotated by size when the config names one. The returned func closes the file
+func newAccessLog(cfg config.AccessLogConfig) (*zap.Logger, func() error) {
+	if cfg.Path == "" {
+		return log.Logger.Named("access"), func() error { return nil }
+	}
+	file := &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMb,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+	}
+	encoder := zap.NewProductionEncoderConfig()
+	encoder.EncodeTime = zapcore.ISO8601TimeEncoder
+	return zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(encoder), zapcore.AddSync(file), zap.InfoLevel)), file.Close
+}
+
+// accessRecord describes one tunnel from the request to the close of both directions
+type accessRecord struct {
+	start  time.Time
+	client string
+	user   string
+	target string
+	// empty when no upstream could be dialed
+	upstream string
+	source   string
+	tries    int
+	connect  time.Duration
+	// bytes from the client to the target and back
+	in     int64
+	out    int64
+	reason string
+}
+
+func newAccessRecord(request *http.Request) *accessRecord {
+	return &accessRecord{
+		start:  time.Now(),
+		client: request.RemoteAddr,
+		user:   proxyUser(request),
+		target: request.Host,
+	}
+}
+
+func (r *accessRecord) write(logger *zap.Logger) {
+	logger.Info("tunnel",
+		zap.String("client", r.client),
+		zap.String("user", r.user),
+		zap.String("target", r.target),
+		zap.String("upstream", r.upstream),
+		zap.String("source", r.source),
+		zap.Int("tries", r.tries),
+		zap.Duration("connect", r.connect),
+		zap.Int64("bytes_in", r.in),
+		zap.Int64("bytes_out", r.out),
+		zap.Duration("duration", time.Since(r.start)),
+		zap.String("reason", r.reason),
+	)
+}
+
+// proxyUser is the user name of the Proxy-Authorization header, the proxy does not verify it
+func proxyUser(request *http.Request) string {
+	header := request.Header.Get("Proxy-Authorization")
+	if !strings.HasPrefix(strings.ToLower(header), "basic ") {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len("basic "):]))
+	if err != nil {
+		return ""
+	}
+	return strings.SplitN(string(decoded), ":", 2)[0]
+}
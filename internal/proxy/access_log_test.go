@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"proxy-pool/config"
+	"proxy-pool/pkg/pool"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestProxyUser(t *testing.T) {
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"user and password", basic("alice:secret"), "alice"},
+		{"password with colons", basic("alice:se:cret"), "alice"},
+		{"user only", basic("alice"), "alice"},
+		{"lowercase scheme", "basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")), "alice"},
+		{"no header", "", ""},
+		{"other scheme", "Bearer token", ""},
+		{"invalid base64", "Basic %%%", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodConnect, "http://target.invalid:443", nil)
+			if tt.header != "" {
+				request.Header.Set("Proxy-Authorization", tt.header)
+			}
+			if got := proxyUser(request); got != tt.want {
+				t.Errorf("proxyUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// readAccessLog returns the records of the file by their close reason
+func readAccessLog(t *testing.T, path string) map[string]map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records := map[string]map[string]interface{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := map[string]interface{}{}
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			t.Fatalf("access log line %q: %v", scanner.Text(), err)
+		}
+		records[record["reason"].(string)] = record
+	}
+	return records
+}
+
+// isOpen tells whether the process holds a descriptor of path, it is only known on linux
+func isOpen(t *testing.T, path string) bool {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range fds {
+		target, _ := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if target == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProxy_accessLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	cfg := &config.Config{
+		ShutdownTimeout: time.Millisecond * 300,
+		Proxy: config.ProxyConfig{
+			MaxTries:    1,
+			DialTimeout: time.Second * 5,
+			AccessLog:   config.AccessLogConfig{Path: path},
+		},
+	}
+	p, server, addr := newTestProxy(t, cfg)
+
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+	closed := openTunnel(t, addr, "Proxy-Authorization: "+auth)
+	_ = closed.Close()
+	// left open until the shutdown cuts it
+	openTunnel(t, addr)
+
+	// without upstreams the next tunnel cannot be dialed
+	entities, err := p.poolService.List(context.Background(), pool.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		err = p.poolService.Delete(context.Background(), e, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = io.WriteString(conn, "CONNECT target.invalid:443 HTTP/1.1\r\nHost: target.invalid:443\r\n\r\n")
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	_, _ = io.ReadAll(conn)
+
+	p.shutdown(server)
+	if runtime.GOOS == "linux" && isOpen(t, path) {
+		t.Error("access log is still open after the shutdown")
+	}
+
+	records := readAccessLog(t, path)
+	client := records[closeClientClosed]
+	if client == nil {
+		t.Fatalf("no %v record in %v", closeClientClosed, records)
+	}
+	if client["user"] != "alice" || client["target"] != "target.invalid:443" || client["source"] != "import" {
+		t.Errorf("%v record = %v, want user alice to target.invalid:443 through an imported upstream", closeClientClosed, client)
+	}
+	if client["upstream"] == "" || client["tries"] != float64(1) {
+		t.Errorf("%v record = %v, want one try of an upstream", closeClientClosed, client)
+	}
+	if client["bytes_in"] != float64(4) || client["bytes_out"] != float64(4) {
+		t.Errorf("%v record bytes = %v in, %v out, want 4 each way", closeClientClosed, client["bytes_in"], client["bytes_out"])
+	}
+	if cut := records[closeShutdown]; cut == nil || cut["user"] != "" {
+		t.Errorf("%v record = %v, want one without a user", closeShutdown, cut)
+	}
+	if failed := records[closeDialFailed]; failed == nil || failed["upstream"] != "" {
+		t.Errorf("%v record = %v, want one without an upstream", closeDialFailed, failed)
+	}
+}
@@ -8,6 +8,6 @@ import (
 	"proxy-pool/pkg/pool"
 )
 
-func NewProxy() *Proxy {
+func NewProxy() (*Proxy, func()) {
 	panic(wire.Build(core.Set, pool.Set, newProxy))
 }
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"proxy-pool/pkg/metrics"
+)
+
+var (
+	activeTunnelsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "tunnels_active",
+		Help:      "Tunnels open on this replica.",
+	})
+	tunnelBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "tunnel_bytes_total",
+		Help:      "Bytes copied through closed tunnels, in from the clients and out to them.",
+	}, []string{"direction"})
+	dialAttempts = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "dial_attempts",
+		Help:      "Upstreams tried for one tunnel request.",
+		Buckets:   prometheus.LinearBuckets(1, 1, 10),
+	})
+	dialRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "dial_retries_total",
+		Help:      "Upstreams tried after the first one of a tunnel request failed.",
+	})
+	upstreamFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "upstream_failures_total",
+		Help:      "Upstreams which could not be dialed by error class.",
+	}, []string{"class"})
+)
@@ -3,33 +3,96 @@ package proxy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"go.uber.org/zap"
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"proxy-pool/config"
 	"proxy-pool/pkg/log"
 	"proxy-pool/pkg/pool"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const maxTryCount = 5
+// tunnelReportInterval is how often the number of open tunnels is pushed to the stats
+const tunnelReportInterval = time.Second * 10
+
+// pacPath is where browsers can fetch the generated proxy auto-config file
+const pacPath = "/proxy.pac"
 
 type Proxy struct {
 	cfg         *config.Config
+	dial        *dialProfile
 	poolService *pool.Service
+	pacService  *pool.PacService
+	// one record per tunnel
+	accessLog *zap.Logger
+	// closes the file of the access log on shutdown
+	closeAccessLog func() error
+	// number of open tunnels, accessed atomically
+	activeTunnels int64
+	// hijacked connections, the http server does not track them
+	tunnels sync.WaitGroup
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	// set once the open tunnels are cut, later ones are cut as they start
+	cut bool
 }
 
 func newProxy(
 	cfg *config.Config,
 	poolService *pool.Service,
+	pacService *pool.PacService,
 ) *Proxy {
+	accessLog, closeAccessLog := newAccessLog(cfg.Proxy.AccessLog)
 	return &Proxy{
-		cfg:         cfg,
-		poolService: poolService,
+		cfg:            cfg,
+		poolService:    poolService,
+		pacService:     pacService,
+		dial:           newDialProfile(cfg),
+		conns:          map[net.Conn]struct{}{},
+		accessLog:      accessLog,
+		closeAccessLog: closeAccessLog,
 	}
 }
 
+// dialProfile is how upstreams are tried for a tunnel, it is replaced on reload
+type dialProfile struct {
+	mu       sync.RWMutex
+	maxTries int
+	timeout  time.Duration
+}
+
+func newDialProfile(cfg *config.Config) *dialProfile {
+	d := &dialProfile{}
+	d.set(cfg)
+	return d
+}
+
+func (d *dialProfile) get() (int, time.Duration) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.maxTries, d.timeout
+}
+
+func (d *dialProfile) set(cfg *config.Config) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxTries, d.timeout = cfg.Proxy.MaxTries, cfg.Proxy.DialTimeout
+}
+
+// Reload applies the tries and the dial timeout of cfg to the next tunnels
+func (p *Proxy) Reload(cfg *config.Config) {
+	p.dial.set(cfg)
+	log.Logger.Info("reloaded proxy",
+		zap.Int("max_tries", cfg.Proxy.MaxTries),
+		zap.Duration("dial_timeout", cfg.Proxy.DialTimeout),
+	)
+}
+
 type halfClosable interface {
 	net.Conn
 	CloseWrite() error
@@ -46,24 +109,53 @@ func (p *Proxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 		}
 	}()
 	log.Logger.Debug("request", zap.String("host", request.Host))
+	if request.Method != http.MethodConnect && !request.URL.IsAbs() && request.URL.Path == pacPath {
+		p.servePac(writer, request)
+		return
+	}
 	hij, ok := writer.(http.Hijacker)
 	if !ok {
 		panic("hijacking the connection is not supported")
 	}
+	// counted while the server still tracks the connection, so a shutdown cannot miss the tunnel
+	p.tunnels.Add(1)
 	sourceConnection, _, err := hij.Hijack()
 	if err != nil {
+		p.tunnels.Done()
 		panic("failed to hijack connection, error: " + err.Error())
 	}
+	record := newAccessRecord(request)
+	tunnelStarted := false
+	defer func() {
+		if !tunnelStarted {
+			// the client would otherwise wait for an answer
+			_ = sourceConnection.Close()
+			if record.reason == "" {
+				record.reason = closeDialFailed
+			}
+			// written before the shutdown may close the access log
+			record.write(p.accessLog)
+			p.tunnels.Done()
+		}
+	}()
 	host := request.Host
-	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second*30)
+	_, dialTimeout := p.dial.get()
+	ctx, cancelFunc := context.WithTimeout(context.Background(), dialTimeout)
 	defer cancelFunc()
-	targetConnection, err := p.tryDialConnectionToHost(ctx, host)
+	targetConnection, err := p.tryDialConnectionToHost(ctx, host, record)
 	if err != nil {
 		panic("failed to dial connection to target host: " + host + ", error: " + err.Error())
 	}
+	record.connect = time.Since(record.start)
+	defer func() {
+		if !tunnelStarted {
+			_ = targetConnection.Close()
+		}
+	}()
 	// success establish connection to target host
 	_, err = sourceConnection.Write([]byte("HTTP/1.0 200 OK\r\n\r\n"))
 	if err != nil {
+		record.reason = closeClientClosed
 		panic("failed to write success header")
 	}
 
@@ -75,25 +167,99 @@ func (p *Proxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	if !ok {
 		panic("failed to cast target connection to closable connection")
 	}
-	go copyAndClose(sourceClosableConn, targetClosableConn)
-	go copyAndClose(targetClosableConn, sourceClosableConn)
+	tunnelStarted = true
+	p.track(sourceConnection, targetConnection)
+	atomic.AddInt64(&p.activeTunnels, 1)
+	activeTunnelsGauge.Inc()
+	var group sync.WaitGroup
+	// the side whose direction ends first closed the tunnel
+	var closed sync.Once
+	group.Add(2)
+	go func() {
+		record.out = copyAndClose(sourceClosableConn, targetClosableConn)
+		closed.Do(func() { record.reason = closeUpstreamClosed })
+		tunnelBytesTotal.WithLabelValues("out").Add(float64(record.out))
+		group.Done()
+	}()
+	go func() {
+		record.in = copyAndClose(targetClosableConn, sourceClosableConn)
+		closed.Do(func() { record.reason = closeClientClosed })
+		tunnelBytesTotal.WithLabelValues("in").Add(float64(record.in))
+		group.Done()
+	}()
+	go func() {
+		group.Wait()
+		if p.untrack(sourceConnection, targetConnection) {
+			record.reason = closeShutdown
+		}
+		record.write(p.accessLog)
+		atomic.AddInt64(&p.activeTunnels, -1)
+		activeTunnelsGauge.Dec()
+		p.tunnels.Done()
+	}()
+}
+
+func (p *Proxy) track(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		if p.cut {
+			_ = conn.Close()
+		}
+		p.conns[conn] = struct{}{}
+	}
 }
 
-func (p Proxy) tryDialConnectionToHost(ctx context.Context, host string) (net.Conn, error) {
-	entities, err := p.poolService.GetByRandom(ctx, maxTryCount)
+// untrack tells whether the tunnels have been cut meanwhile
+func (p *Proxy) untrack(conns ...net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		delete(p.conns, conn)
+	}
+	return p.cut
+}
+
+// closeTunnels cuts the open tunnels, their copies return with an error
+func (p *Proxy) closeTunnels() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cut = true
+	for conn := range p.conns {
+		_ = conn.Close()
+	}
+}
+
+func (p *Proxy) servePac(writer http.ResponseWriter, request *http.Request) {
+	pac, err := p.pacService.Generate(request.Context(), request.Host)
+	if err != nil {
+		log.Logger.Error("failed to generate pac file", zap.Error(err))
+		writer.WriteHeader(500)
+		_, _ = writer.Write([]byte("internal server error"))
+		return
+	}
+	writer.Header().Set("Content-Type", pool.FormatPac.ContentType())
+	_, _ = writer.Write([]byte(pac))
+}
+
+// tryDialConnectionToHost notes the upstreams it tries in record
+func (p *Proxy) tryDialConnectionToHost(ctx context.Context, host string, record *accessRecord) (net.Conn, error) {
+	maxTries, _ := p.dial.get()
+	entities, err := p.poolService.GetByRandom(ctx, int64(maxTries))
 	if err != nil {
 		return nil, err
 	}
 	tryCount := 1
 	var targetConnection net.Conn
-	for tryCount <= min(maxTryCount, len(entities)) {
+	for tryCount <= min(maxTries, len(entities)) {
 		entity := entities[tryCount-1]
 		dialFunc := entity.GetDialFunc()
 		log.Logger.Debug("trying proxy", zap.String("proxy", entity.GetProxyUri()), zap.Int("tryCount", tryCount))
 		targetConnection, err = dialFunc("tcp", host)
 		if err != nil {
 			log.Logger.Debug("trying proxy error", zap.Error(err))
-			err := p.poolService.Delete(ctx, entity)
+			upstreamFailuresTotal.WithLabelValues(string(pool.ClassifyError(err))).Inc()
+			err := p.poolService.Delete(ctx, entity, pool.ReasonDialFailed)
 			if err != nil {
 				log.Logger.Warn("remove from pool error", zap.Error(err))
 			}
@@ -102,9 +268,19 @@ func (p Proxy) tryDialConnectionToHost(ctx context.Context, host string) (net.Co
 		}
 		break
 	}
-	if tryCount > min(maxTryCount, len(entities)) {
+	tried := min(tryCount, min(maxTries, len(entities)))
+	record.tries = tried
+	if tried > 0 {
+		dialAttempts.Observe(float64(tried))
+		dialRetriesTotal.Add(float64(tried - 1))
+	}
+	if tryCount > min(maxTries, len(entities)) {
 		return nil, errors.New("maximum retry reached")
 	}
+	selected := entities[tryCount-1]
+	record.upstream = fmt.Sprintf("%v://%v:%v", selected.Type, selected.Ip, selected.Port)
+	record.source = selected.Source
+	p.poolService.Used(selected)
 	return targetConnection, nil
 }
 
@@ -115,17 +291,82 @@ func min(x, y int) int {
 	return x
 }
 
-func copyAndClose(sourceConn halfClosable, destConn halfClosable) {
-	_, err := io.Copy(sourceConn, destConn)
+// copyAndClose copies destConn into sourceConn and returns the number of bytes copied
+func copyAndClose(sourceConn halfClosable, destConn halfClosable) int64 {
+	n, err := io.Copy(sourceConn, destConn)
 	if err != nil {
 		log.Logger.Error("error copy to dest: " + err.Error())
 	}
 	_ = sourceConn.CloseRead()
 	_ = destConn.CloseWrite()
+	return n
 }
 
-func (p *Proxy) Start() error {
-	go p.poolService.Start(context.Background())
-	log.Logger.Info("starting proxy server")
-	return http.ListenAndServe(":3001", p)
+func (p *Proxy) reportTunnels(ctx context.Context) {
+	hostname, _ := os.Hostname()
+	replica := fmt.Sprintf("%v:%v", hostname, os.Getpid())
+	ticker := time.NewTicker(tunnelReportInterval)
+	defer ticker.Stop()
+	for {
+		err := p.poolService.ReportTunnels(ctx, replica, atomic.LoadInt64(&p.activeTunnels))
+		if err != nil {
+			log.Logger.Warn("failed to report tunnels", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start serves until ctx is done, then stops accepting connections and waits for the open tunnels
+func (p *Proxy) Start(ctx context.Context) error {
+	go p.reportTunnels(ctx)
+	server := &http.Server{Addr: p.cfg.Proxy.Listen, Handler: p}
+	errs := make(chan error, 1)
+	go func() {
+		log.Logger.Info("starting proxy server", zap.String("addr", p.cfg.Proxy.Listen))
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	p.shutdown(server)
+	return nil
+}
+
+// shutdown waits for the tunnels up to the shutdown timeout, the ones still open then are cut
+func (p *Proxy) shutdown(server *http.Server) {
+	log.Logger.Info("shutting down proxy server",
+		zap.Int64("tunnels", atomic.LoadInt64(&p.activeTunnels)),
+		zap.Duration("timeout", p.cfg.ShutdownTimeout),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.ShutdownTimeout)
+	defer cancel()
+	// only waits for pac requests, tunnels are hijacked
+	err := server.Shutdown(ctx)
+	if err != nil {
+		_ = server.Close()
+	}
+	drained := make(chan struct{})
+	go func() {
+		p.tunnels.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.Logger.Info("all tunnels closed")
+	case <-ctx.Done():
+		log.Logger.Warn("cutting tunnels still open", zap.Int64("tunnels", atomic.LoadInt64(&p.activeTunnels)))
+		p.closeTunnels()
+		<-drained
+	}
+	_ = p.accessLog.Sync()
+	err = p.closeAccessLog()
+	if err != nil {
+		log.Logger.Warn("failed to close access log", zap.Error(err))
+	}
 }
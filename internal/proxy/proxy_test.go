@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"io"
+	"net"
+	"net/http"
+	"proxy-pool/config"
+	"proxy-pool/pkg/pool"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUpstream is an http proxy which opens every tunnel to an echo of the client
+func newTestUpstream(t *testing.T) *pool.Proxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				_, err := http.ReadRequest(reader)
+				if err != nil {
+					return
+				}
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				_, _ = io.Copy(conn, reader)
+			}()
+		}
+	}()
+	return &pool.Proxy{Ip: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, Type: pool.Http}
+}
+
+// newTestProxy serves a proxy whose pool holds one upstream
+func newTestProxy(t *testing.T, cfg *config.Config) (*Proxy, *http.Server, string) {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	events := pool.NewEventBus(client)
+	stats := pool.NewStatsService(client)
+	repository := pool.NewRepository(client)
+	checker := pool.NewCheckerService(cfg, client, events, stats)
+	expiry := pool.NewExpiryService(cfg, repository, checker, events)
+	poolService := pool.NewPoolService(repository, nil, checker, events, nil, stats, expiry, nil)
+	_, err = poolService.Import(context.Background(), []*pool.Proxy{newTestUpstream(t)}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newProxy(cfg, poolService, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := &http.Server{Handler: p}
+	go func() { _ = httpServer.Serve(listener) }()
+	t.Cleanup(func() { _ = httpServer.Close() })
+	return p, httpServer, listener.Addr().String()
+}
+
+// openTunnel connects through the proxy with the header lines given and checks the tunnel carries data
+func openTunnel(t *testing.T, addr string, headers ...string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	request := "CONNECT target.invalid:443 HTTP/1.1\r\nHost: target.invalid:443\r\n"
+	for _, header := range headers {
+		request += header + "\r\n"
+	}
+	_, _ = io.WriteString(conn, request+"\r\n")
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil || !strings.Contains(status, "200") {
+		t.Fatalf("CONNECT = %q %v, want 200", status, err)
+	}
+	_, _ = reader.ReadString('\n')
+	_, _ = io.WriteString(conn, "ping")
+	echo := make([]byte, 4)
+	_, err = io.ReadFull(reader, echo)
+	if err != nil || string(echo) != "ping" {
+		t.Fatalf("tunnel returned %q %v, want the echo", echo, err)
+	}
+	return conn
+}
+
+func TestProxy_shutdown(t *testing.T) {
+	cfg := &config.Config{
+		ShutdownTimeout: time.Second * 2,
+		Proxy:           config.ProxyConfig{MaxTries: 1, DialTimeout: time.Second * 5},
+	}
+
+	t.Run("waits for open tunnels", func(t *testing.T) {
+		p, server, addr := newTestProxy(t, cfg)
+		conn := openTunnel(t, addr)
+		done := make(chan struct{})
+		go func() {
+			p.shutdown(server)
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("shutdown() returned while a tunnel was open")
+		case <-time.After(time.Millisecond * 300):
+		}
+		_ = conn.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("shutdown() did not return once the tunnel was closed")
+		}
+	})
+
+	t.Run("cuts tunnels at the deadline", func(t *testing.T) {
+		p, server, addr := newTestProxy(t, cfg)
+		conn := openTunnel(t, addr)
+		start := time.Now()
+		p.shutdown(server)
+		if elapsed := time.Since(start); elapsed > cfg.ShutdownTimeout+time.Second {
+			t.Errorf("shutdown() took %v, want about %v", elapsed, cfg.ShutdownTimeout)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := conn.Read(make([]byte, 1))
+		if err != io.EOF {
+			t.Errorf("Read() on a cut tunnel = %v, want EOF", err)
+		}
+	})
+}
@@ -12,13 +12,21 @@ import (
 
 // Injectors from injector.go:
 
-func NewProxy() *Proxy {
+func NewProxy() (*Proxy, func()) {
 	config := core.ProvideConfig()
-	client := core.ProvideRedis(config)
+	client, cleanup := core.ProvideRedisClient(config)
 	repository := pool.NewRepository(client)
-	checkerService := pool.NewCheckerService(client)
-	fetcherJob := pool.NewFetcherJob(checkerService)
-	service := pool.NewPoolService(repository, fetcherJob, checkerService)
-	proxy := newProxy(config, service)
-	return proxy
+	eventBus := pool.NewEventBus(client)
+	statsService := pool.NewStatsService(client)
+	checkerService := pool.NewCheckerService(config, client, eventBus, statsService)
+	fetcherJob := pool.NewFetcherJob(config, repository, checkerService, eventBus, statsService)
+	alertService := pool.NewAlertService(config, repository, eventBus)
+	expiryService := pool.NewExpiryService(config, repository, checkerService, eventBus)
+	leaderElection := pool.NewLeaderElection(config, client)
+	service := pool.NewPoolService(repository, fetcherJob, checkerService, eventBus, alertService, statsService, expiryService, leaderElection)
+	pacService := pool.NewPacService(config, client)
+	proxy := newProxy(config, service, pacService)
+	return proxy, func() {
+		cleanup()
+	}
 }
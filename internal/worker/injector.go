@@ -0,0 +1,13 @@
+//+build wireinject
+
+package worker
+
+import (
+	"github.com/google/wire"
+	"proxy-pool/internal/core"
+	"proxy-pool/pkg/pool"
+)
+
+func NewWorker() (*Worker, func()) {
+	panic(wire.Build(core.Set, pool.Set, newWorker))
+}
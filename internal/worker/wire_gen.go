@@ -0,0 +1,31 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run github.com/google/wire/cmd/wire
+//+build !wireinject
+
+package worker
+
+import (
+	"proxy-pool/internal/core"
+	"proxy-pool/pkg/pool"
+)
+
+// Injectors from injector.go:
+
+func NewWorker() (*Worker, func()) {
+	config := core.ProvideConfig()
+	client, cleanup := core.ProvideRedisClient(config)
+	repository := pool.NewRepository(client)
+	eventBus := pool.NewEventBus(client)
+	statsService := pool.NewStatsService(client)
+	checkerService := pool.NewCheckerService(config, client, eventBus, statsService)
+	fetcherJob := pool.NewFetcherJob(config, repository, checkerService, eventBus, statsService)
+	alertService := pool.NewAlertService(config, repository, eventBus)
+	expiryService := pool.NewExpiryService(config, repository, checkerService, eventBus)
+	leaderElection := pool.NewLeaderElection(config, client)
+	service := pool.NewPoolService(repository, fetcherJob, checkerService, eventBus, alertService, statsService, expiryService, leaderElection)
+	worker := newWorker(service)
+	return worker, func() {
+		cleanup()
+	}
+}
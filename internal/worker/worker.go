@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"proxy-pool/pkg/pool"
+)
+
+// Worker runs the background roles of the pool, it serves no requests
+type Worker struct {
+	poolService *pool.Service
+}
+
+func newWorker(poolService *pool.Service) *Worker {
+	return &Worker{poolService: poolService}
+}
+
+// StartFetcher competes for the fetcher leader lock and schedules the fetchers while holding it
+func (w *Worker) StartFetcher(ctx context.Context) {
+	log.Logger.Info("starting fetcher worker")
+	w.poolService.StartFetcher(ctx)
+}
+
+// StartChecker checks the proxies the fetchers queued
+func (w *Worker) StartChecker(ctx context.Context) {
+	log.Logger.Info("starting checker worker")
+	w.poolService.StartChecker(ctx)
+}
+
+// Reload applies the fetchers, their schedules and the check settings of cfg without a restart
+func (w *Worker) Reload(cfg *config.Config) {
+	w.poolService.Reload(cfg)
+}
+
+// ReloadFetchers applies the fetchers and their schedules of cfg, for the fetcher role
+func (w *Worker) ReloadFetchers(cfg *config.Config) {
+	w.poolService.ReloadFetchers(cfg)
+}
+
+// ReloadChecker applies the check settings of cfg, for the checker role
+func (w *Worker) ReloadChecker(cfg *config.Config) {
+	w.poolService.ReloadChecker(cfg)
+}
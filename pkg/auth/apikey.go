@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Scope string
+
+const (
+	ScopePoolRead        Scope = "pool:read"
+	ScopeCredentialsRead Scope = "credentials:read"
+	ScopePoolWrite       Scope = "pool:write"
+	// ScopeAdmin grants every other scope
+	ScopeAdmin Scope = "admin"
+)
+
+const (
+	keyPrefix   = "apikey:"
+	keyIndexKey = "index:apikey:set"
+	tokenPrefix = "pp"
+	// bytes of the random key id, ids are checked for collisions too
+	keyIdBytes = 8
+	// ids drawn before Create gives up on collisions
+	createKeyAttempts = 3
+)
+
+var (
+	ErrInvalidKey   = errors.New("invalid api key")
+	ErrKeyNotFound  = errors.New("api key not found")
+	ErrUnknownScope = errors.New("unknown scope")
+	ErrNoScope      = errors.New("at least one scope is required")
+	ErrKeyIdTaken   = errors.New("api key id already taken")
+)
+
+// stores a key unless its id is taken, an existing key is never overwritten
+var createKeyScript = redis.NewScript(`
+if redis.call("exists", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("hset", KEYS[1], "name", ARGV[1], "hash", ARGV[2], "scopes", ARGV[3], "created_at", ARGV[4])
+redis.call("sadd", KEYS[2], ARGV[5])
+return 1`)
+
+func ParseScope(s string) (Scope, error) {
+	s = strings.TrimSpace(s)
+	s = strings.ToLower(s)
+	switch Scope(s) {
+	case ScopePoolRead, ScopeCredentialsRead, ScopePoolWrite, ScopeAdmin:
+		return Scope(s), nil
+	default:
+		return "", fmt.Errorf("%w: %v", ErrUnknownScope, s)
+	}
+}
+
+// ApiKey is the stored part of a key, the token itself is only known to its owner
+type ApiKey struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []Scope   `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	hash      string
+}
+
+func (k *ApiKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type ApiKeyService struct {
+	redis *redis.Client
+}
+
+func NewApiKeyService(redis *redis.Client) *ApiKeyService {
+	return &ApiKeyService{redis: redis}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores a new key and returns the token, which can not be recovered later
+func (s ApiKeyService) Create(ctx context.Context, name string, scopes []Scope) (*ApiKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", ErrNoScope
+	}
+	for i := 0; i < createKeyAttempts; i++ {
+		id, err := randomHex(keyIdBytes)
+		if err != nil {
+			return nil, "", err
+		}
+		secret, err := randomHex(24)
+		if err != nil {
+			return nil, "", err
+		}
+		token := fmt.Sprintf("%v_%v_%v", tokenPrefix, id, secret)
+		key := &ApiKey{
+			Id:        id,
+			Name:      name,
+			Scopes:    scopes,
+			CreatedAt: time.Now(),
+			hash:      hashToken(token),
+		}
+		err = s.store(ctx, key)
+		if errors.Is(err, ErrKeyIdTaken) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return key, token, nil
+	}
+	return nil, "", ErrKeyIdTaken
+}
+
+// store saves a new key, ErrKeyIdTaken tells another key has its id
+func (s ApiKeyService) store(ctx context.Context, key *ApiKey) error {
+	scopeNames := make([]string, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopeNames = append(scopeNames, string(scope))
+	}
+	stored, err := createKeyScript.Run(ctx, s.redis, []string{keyPrefix + key.Id, keyIndexKey},
+		key.Name, key.hash, strings.Join(scopeNames, ","), strconv.FormatInt(key.CreatedAt.Unix(), 10), key.Id,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if stored == 0 {
+		return ErrKeyIdTaken
+	}
+	return nil
+}
+
+func (s ApiKeyService) get(ctx context.Context, id string) (*ApiKey, error) {
+	m, err := s.redis.HGetAll(ctx, keyPrefix+id).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	key := &ApiKey{
+		Id:   id,
+		Name: m["name"],
+		hash: m["hash"],
+	}
+	for _, scope := range strings.Split(m["scopes"], ",") {
+		if scope != "" {
+			key.Scopes = append(key.Scopes, Scope(scope))
+		}
+	}
+	createdAt, _ := strconv.ParseInt(m["created_at"], 10, 64)
+	key.CreatedAt = time.Unix(createdAt, 0)
+	return key, nil
+}
+
+// Verify returns the key the token belongs to
+func (s ApiKeyService) Verify(ctx context.Context, token string) (*ApiKey, error) {
+	parts := strings.SplitN(token, "_", 3)
+	if len(parts) != 3 || parts[0] != tokenPrefix {
+		return nil, ErrInvalidKey
+	}
+	key, err := s.get(ctx, parts[1])
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.hash), []byte(hashToken(token))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+func (s ApiKeyService) Revoke(ctx context.Context, id string) error {
+	pipeline := s.redis.Pipeline()
+	del := pipeline.Del(ctx, keyPrefix+id)
+	pipeline.SRem(ctx, keyIndexKey, id)
+	_, err := pipeline.Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if del.Val() == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (s ApiKeyService) List(ctx context.Context) ([]*ApiKey, error) {
+	ids, err := s.redis.SMembers(ctx, keyIndexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*ApiKey, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.get(ctx, id)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
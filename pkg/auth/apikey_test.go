@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"strings"
+	"testing"
+)
+
+func newTestService(t *testing.T) *ApiKeyService {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewApiKeyService(client)
+}
+
+func TestParseScope(t *testing.T) {
+	scope, err := ParseScope(" Pool:Write ")
+	if err != nil || scope != ScopePoolWrite {
+		t.Errorf("ParseScope() = %v %v, want %v", scope, err, ScopePoolWrite)
+	}
+	_, err = ParseScope("pool:delete")
+	if !errors.Is(err, ErrUnknownScope) {
+		t.Errorf("ParseScope() error = %v, want %v", err, ErrUnknownScope)
+	}
+}
+
+func TestApiKey_HasScope(t *testing.T) {
+	reader := &ApiKey{Scopes: []Scope{ScopePoolRead}}
+	if !reader.HasScope(ScopePoolRead) || reader.HasScope(ScopePoolWrite) || reader.HasScope(ScopeAdmin) {
+		t.Errorf("pool:read key has scopes %v", reader.Scopes)
+	}
+	admin := &ApiKey{Scopes: []Scope{ScopeAdmin}}
+	for _, scope := range []Scope{ScopePoolRead, ScopePoolWrite, ScopeCredentialsRead, ScopeAdmin} {
+		if !admin.HasScope(scope) {
+			t.Errorf("admin key lacks %v", scope)
+		}
+	}
+}
+
+func TestApiKeyService(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+
+	_, _, err := s.Create(ctx, "none", nil)
+	if !errors.Is(err, ErrNoScope) {
+		t.Errorf("Create() without scopes error = %v, want %v", err, ErrNoScope)
+	}
+	key, token, err := s.Create(ctx, "ci", []Scope{ScopePoolRead, ScopePoolWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, "_")
+	if len(parts) != 3 || parts[0] != tokenPrefix || parts[1] != key.Id || parts[2] == "" {
+		t.Errorf("token = %q, want pp_<id>_<secret>", token)
+	}
+	stored, err := s.redis.HGet(ctx, keyPrefix+key.Id, "hash").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != hashToken(token) || strings.Contains(stored, parts[2]) {
+		t.Errorf("stored hash = %q, want the sha256 of the token", stored)
+	}
+
+	verified, err := s.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if verified.Id != key.Id || verified.Name != "ci" || !verified.HasScope(ScopePoolWrite) || verified.HasScope(ScopeAdmin) {
+		t.Errorf("Verify() = %+v", verified)
+	}
+	for _, invalid := range []string{
+		"",
+		token[:len(token)-1],
+		"xx_" + key.Id + "_" + parts[2],
+		"pp_ffffffff_" + parts[2],
+		"pp_" + key.Id,
+	} {
+		_, err := s.Verify(ctx, invalid)
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Verify(%q) error = %v, want %v", invalid, err, ErrInvalidKey)
+		}
+	}
+
+	other, _, err := s.Create(ctx, "admin", []Scope{ScopeAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("List() returned %v keys, want 2", len(keys))
+	}
+
+	err = s.Revoke(ctx, key.Id)
+	if err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	_, err = s.Verify(ctx, token)
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Verify() of a revoked key error = %v, want %v", err, ErrInvalidKey)
+	}
+	err = s.Revoke(ctx, key.Id)
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Revoke() twice error = %v, want %v", err, ErrKeyNotFound)
+	}
+	keys, err = s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Id != other.Id {
+		t.Errorf("List() after Revoke() = %v, want only %v", keys, other.Id)
+	}
+}
+
+func TestApiKeyService_store(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	key, token, err := s.Create(ctx, "ci", []Scope{ScopePoolRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key.Id) != keyIdBytes*2 {
+		t.Errorf("key id = %q, want %v random bytes", key.Id, keyIdBytes)
+	}
+
+	taken := &ApiKey{Id: key.Id, Name: "other", Scopes: []Scope{ScopeAdmin}, hash: hashToken("other")}
+	err = s.store(ctx, taken)
+	if !errors.Is(err, ErrKeyIdTaken) {
+		t.Errorf("store() of a taken id error = %v, want %v", err, ErrKeyIdTaken)
+	}
+	verified, err := s.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("Verify() of the first key error = %v", err)
+	}
+	if verified.Name != "ci" || verified.HasScope(ScopeAdmin) {
+		t.Errorf("Verify() = %+v, want the first key unchanged", verified)
+	}
+}
@@ -0,0 +1,16 @@
+package auth
+
+import "context"
+
+type contextKey struct{}
+
+// WithKey attaches the authenticated key to ctx
+func WithKey(ctx context.Context, key *ApiKey) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// HasScope reports whether the key attached to ctx grants scope
+func HasScope(ctx context.Context, scope Scope) bool {
+	key, ok := ctx.Value(contextKey{}).(*ApiKey)
+	return ok && key.HasScope(scope)
+}
@@ -0,0 +1,5 @@
+package auth
+
+import "github.com/google/wire"
+
+var Set = wire.NewSet(NewApiKeyService)
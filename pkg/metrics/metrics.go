@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net/http"
+	"proxy-pool/pkg/log"
+)
+
+// Namespace prefixes the name of every metric of the pool
+const Namespace = "proxy_pool"
+
+// Handler serves the metrics of the process in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve exposes the metrics of the process on addr until ctx is done
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+	errs := make(chan error, 1)
+	go func() {
+		log.Logger.Info("starting metrics server", zap.String("addr", addr))
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	// scrapes are short, the last one is not worth waiting for
+	return server.Close()
+}
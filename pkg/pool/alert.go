@@ -0,0 +1,276 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAlertInterval   = time.Minute
+	defaultWebhookRetries  = 3
+	defaultWebhookTimeout  = time.Second * 10
+	webhookSignatureHeader = "X-Proxy-Pool-Signature"
+)
+
+type AlertType string
+
+const (
+	AlertPoolLow            AlertType = "pool_low"
+	AlertPoolRecovered      AlertType = "pool_recovered"
+	AlertFetcherFailing     AlertType = "fetcher_failing"
+	AlertFetcherRecovered   AlertType = "fetcher_recovered"
+	AlertErrorRateHigh      AlertType = "error_rate_high"
+	AlertErrorRateRecovered AlertType = "error_rate_recovered"
+)
+
+// Alert is the json body posted to every configured webhook
+type Alert struct {
+	Type      AlertType `json:"type"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Fetcher   string    `json:"fetcher,omitempty"`
+}
+
+// alertState de-bounces alerts: an alert fires once when its condition starts,
+// once more when it recovers, and never more often than every interval
+type alertState struct {
+	interval time.Duration
+	active   map[string]bool
+	lastSent map[string]time.Time
+}
+
+func newAlertState(interval time.Duration) *alertState {
+	return &alertState{
+		interval: interval,
+		active:   map[string]bool{},
+		lastSent: map[string]time.Time{},
+	}
+}
+
+// update returns whether the change of the condition must be notified
+func (s *alertState) update(key string, active bool, now time.Time) bool {
+	if s.active[key] == active {
+		return false
+	}
+	if active && now.Sub(s.lastSent[key]) < s.interval {
+		return false
+	}
+	s.active[key] = active
+	s.lastSent[key] = now
+	return true
+}
+
+type AlertService struct {
+	cfg        *config.Config
+	repository *repository
+	events     *EventBus
+	client     *http.Client
+
+	mu              sync.Mutex
+	fetcherFailures map[string]int
+	dialFailures    int
+	dialSuccesses   int
+}
+
+func NewAlertService(cfg *config.Config, repository *repository, events *EventBus) *AlertService {
+	return &AlertService{
+		cfg:             cfg,
+		repository:      repository,
+		events:          events,
+		client:          &http.Client{Timeout: defaultWebhookTimeout},
+		fetcherFailures: map[string]int{},
+	}
+}
+
+func (a *AlertService) interval() time.Duration {
+	if a.cfg.Alert.Interval > 0 {
+		return a.cfg.Alert.Interval
+	}
+	return defaultAlertInterval
+}
+
+// Start watches pool events and health until ctx is done, it is a no-op without webhooks
+func (a *AlertService) Start(ctx context.Context) {
+	if len(a.cfg.Webhook.Urls) == 0 {
+		return
+	}
+	log.Logger.Info("starting webhook alerts", zap.Int("webhooks", len(a.cfg.Webhook.Urls)))
+	state := newAlertState(a.interval())
+	events := a.events.Subscribe(ctx)
+	ticker := time.NewTicker(a.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			a.record(ctx, state, event)
+		case <-ticker.C:
+			a.evaluate(ctx, state)
+		}
+	}
+}
+
+func (a *AlertService) record(ctx context.Context, state *alertState, event Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch event.Type {
+	case EventProxySelected:
+		a.dialSuccesses++
+	case EventProxyRemoved, EventProxyDemoted:
+		if event.Reason == ReasonDialFailed {
+			a.dialFailures++
+		}
+	case EventFetcherFinished:
+		if event.Error != "" {
+			a.fetcherFailures[event.Fetcher]++
+		} else {
+			a.fetcherFailures[event.Fetcher] = 0
+		}
+		threshold := a.cfg.Alert.FetcherFailures
+		if threshold <= 0 {
+			return
+		}
+		failures := a.fetcherFailures[event.Fetcher]
+		failing := failures >= threshold
+		if state.update("fetcher:"+event.Fetcher, failing, time.Now()) {
+			alert := Alert{
+				Type:      AlertFetcherRecovered,
+				Message:   fmt.Sprintf("fetcher %v recovered", event.Fetcher),
+				Value:     float64(failures),
+				Threshold: float64(threshold),
+				Fetcher:   event.Fetcher,
+			}
+			if failing {
+				alert.Type = AlertFetcherFailing
+				alert.Message = fmt.Sprintf("fetcher %v failed %v times in a row: %v", event.Fetcher, failures, event.Error)
+			}
+			go a.send(ctx, alert)
+		}
+	}
+}
+
+func (a *AlertService) evaluate(ctx context.Context, state *alertState) {
+	now := time.Now()
+	if threshold := a.cfg.Alert.MinPoolSize; threshold > 0 {
+		size, err := a.repository.count(ctx)
+		if err != nil {
+			log.Logger.Warn("failed to count pool for alerts", zap.Error(err))
+		} else {
+			low := size < int64(threshold)
+			if state.update("pool", low, now) {
+				alert := Alert{
+					Type:      AlertPoolRecovered,
+					Message:   fmt.Sprintf("pool recovered to %v proxies", size),
+					Value:     float64(size),
+					Threshold: float64(threshold),
+				}
+				if low {
+					alert.Type = AlertPoolLow
+					alert.Message = fmt.Sprintf("pool has %v proxies, below %v", size, threshold)
+				}
+				go a.send(ctx, alert)
+			}
+		}
+	}
+
+	a.mu.Lock()
+	failures, successes := a.dialFailures, a.dialSuccesses
+	a.dialFailures, a.dialSuccesses = 0, 0
+	a.mu.Unlock()
+	if threshold := a.cfg.Alert.ErrorRate; threshold > 0 && failures+successes > 0 {
+		rate := float64(failures) / float64(failures+successes)
+		high := rate >= threshold
+		if state.update("error_rate", high, now) {
+			alert := Alert{
+				Type:      AlertErrorRateRecovered,
+				Message:   fmt.Sprintf("upstream error rate recovered to %.2f", rate),
+				Value:     rate,
+				Threshold: threshold,
+			}
+			if high {
+				alert.Type = AlertErrorRateHigh
+				alert.Message = fmt.Sprintf("upstream error rate %.2f over the last %v", rate, a.interval())
+			}
+			go a.send(ctx, alert)
+		}
+	}
+}
+
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *AlertService) send(ctx context.Context, alert Alert) {
+	alert.Time = time.Now()
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		log.Logger.Error("failed to marshal alert", zap.Error(err))
+		return
+	}
+	log.Logger.Info("sending alert", zap.String("type", string(alert.Type)), zap.String("message", alert.Message))
+	for _, url := range a.cfg.Webhook.Urls {
+		err := a.post(ctx, url, payload)
+		if err != nil {
+			log.Logger.Error("failed to deliver webhook", zap.String("url", url), zap.Error(err))
+		}
+	}
+}
+
+// post delivers the payload, retrying with exponential backoff
+func (a *AlertService) post(ctx context.Context, url string, payload []byte) error {
+	retries := a.cfg.Webhook.Retries
+	if retries <= 0 {
+		retries = defaultWebhookRetries
+	}
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if a.cfg.Webhook.Secret != "" {
+			req.Header.Set(webhookSignatureHeader, signPayload(a.cfg.Webhook.Secret, payload))
+		}
+		var resp *http.Response
+		resp, err = a.client.Do(req)
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("webhook responded with status %v", resp.StatusCode)
+	}
+	return err
+}
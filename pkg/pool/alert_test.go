@@ -0,0 +1,37 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertState_Update(t *testing.T) {
+	state := newAlertState(time.Minute)
+	now := time.Now()
+	if state.update("pool", false, now) {
+		t.Error("healthy pool must not alert")
+	}
+	if !state.update("pool", true, now) {
+		t.Error("expected alert when pool becomes low")
+	}
+	if state.update("pool", true, now.Add(time.Second)) {
+		t.Error("expected no repeated alert while still low")
+	}
+	if !state.update("pool", false, now.Add(time.Second*2)) {
+		t.Error("expected recovery alert")
+	}
+	if state.update("pool", true, now.Add(time.Second*3)) {
+		t.Error("expected flapping alert to be de-bounced")
+	}
+	if !state.update("pool", true, now.Add(time.Minute*2)) {
+		t.Error("expected alert after the interval passed")
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	// echo -n '{}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+	if got := signPayload("secret", []byte("{}")); got != expected {
+		t.Errorf("unexpected signature %v", got)
+	}
+}
@@ -4,54 +4,163 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
-	"h12.io/socks"
+	"io"
 	"net"
 	"net/http"
-	"net/url"
+	"proxy-pool/config"
 	"proxy-pool/pkg/log"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 const queueName = "checker:proxy:queue"
-const maxConcurrentCheck = 20
+
+// used when the config leaves them unset
+const (
+	defaultCheckUrl         = "https://m.tiktok.com"
+	defaultCheckTimeout     = time.Second * 10
+	defaultCheckConcurrency = 20
+	// time left to a check after the probe to store its result
+	checkPersistTimeout = time.Second * 5
+)
+
+// ErrorClass tells why a proxy failed the check
+type ErrorClass string
+
+const (
+	ErrorClassTimeout ErrorClass = "timeout"
+	ErrorClassDns     ErrorClass = "dns"
+	ErrorClassRefused ErrorClass = "refused"
+	ErrorClassReset   ErrorClass = "reset"
+	ErrorClassAuth    ErrorClass = "proxy_auth"
+	ErrorClassTls     ErrorClass = "tls"
+	ErrorClassStatus  ErrorClass = "status"
+	ErrorClassOther   ErrorClass = "other"
+)
+
+// CheckResult describes one probe, Err and Class are empty when the proxy passed
+type CheckResult struct {
+	Latency time.Duration
+	Class   ErrorClass
+	Err     error
+}
 
 type CheckerService struct {
-	redis *redis.Client
+	redis       *redis.Client
+	events      *EventBus
+	stats       *StatsService
+	profile     *checkProfile
+	concurrency int
 }
 
-func NewCheckerService(redis *redis.Client) *CheckerService {
-	return &CheckerService{redis: redis}
+// checkProfile is how a proxy is checked, it is replaced on reload
+type checkProfile struct {
+	mu      sync.RWMutex
+	url     string
+	timeout time.Duration
 }
 
-func (c *CheckerService) Check(entity *entity) bool {
-	//log.Logger.Info("start checking", zap.String("proxy", entity.GetProxyUri()))
-	var tr *http.Transport
-	if entity.Type == Socks4 || entity.Type == Socks5 {
-		dial := socks.Dial(entity.GetProxyUri())
-		tr = &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dial(network, addr)
-		}}
-	} else {
-		tr = &http.Transport{
-			Proxy: func(*http.Request) (*url.URL, error) {
-				return url.Parse(entity.GetProxyUri())
-			},
-		}
+func (p *checkProfile) get() (string, time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.url, p.timeout
+}
+
+func (p *checkProfile) set(cfg *config.Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.url, p.timeout = cfg.Checker.Url, cfg.Checker.Timeout
+	if p.url == "" {
+		p.url = defaultCheckUrl
+	}
+	if p.timeout <= 0 {
+		p.timeout = defaultCheckTimeout
 	}
+}
+
+func NewCheckerService(cfg *config.Config, redis *redis.Client, events *EventBus, stats *StatsService) *CheckerService {
+	c := &CheckerService{
+		redis:       redis,
+		events:      events,
+		stats:       stats,
+		profile:     &checkProfile{},
+		concurrency: cfg.Checker.Concurrency,
+	}
+	c.profile.set(cfg)
+	if c.concurrency <= 0 {
+		c.concurrency = defaultCheckConcurrency
+	}
+	return c
+}
+
+// Reload applies the check url and timeout of cfg to the next checks
+func (c *CheckerService) Reload(cfg *config.Config) {
+	c.profile.set(cfg)
+}
+
+// Check tells whether the proxy passes the probe
+func (c *CheckerService) Check(entity *entity) bool {
+	return c.Probe(context.Background(), entity).Err == nil
+}
+
+// Probe requests the check url through the proxy and reports how it went
+func (c *CheckerService) Probe(ctx context.Context, entity *entity) CheckResult {
+	// a gateway is checked as one endpoint through any of its exits
+	entity = entity.randomExit()
+	url, timeout := c.profile.get()
 	client := &http.Client{
-		Timeout:   time.Second * 10,
-		Transport: tr,
+		Timeout:   timeout,
+		Transport: entity.transport(),
 	}
-	resp, err := client.Get("https://m.tiktok.com")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		//log.Logger.Info("check failed",
-		//	zap.String("proxy", entity.GetProxyUri()),
-		//)
-		return false
+		return CheckResult{Err: err, Class: ErrorClassOther}
 	}
-	return resp.StatusCode == http.StatusOK
+	start := time.Now()
+	resp, err := client.Do(request)
+	result := CheckResult{Latency: time.Since(start)}
+	if err != nil {
+		result.Err, result.Class = err, ClassifyError(err)
+		return result
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		result.Err, result.Class = fmt.Errorf("unexpected status %v", resp.Status), ErrorClassAuth
+	case resp.StatusCode != http.StatusOK:
+		result.Err, result.Class = fmt.Errorf("unexpected status %v", resp.Status), ErrorClassStatus
+	}
+	return result
+}
+
+// ClassifyError sorts the failure of a probe into what went wrong on the way
+func ClassifyError(err error) ErrorClass {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrorClassDns
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassReset
+	}
+	// the proxy and tls errors of the transport are not typed
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "Proxy Authentication Required"):
+		return ErrorClassAuth
+	case strings.Contains(message, "tls:"), strings.Contains(message, "x509:"):
+		return ErrorClassTls
+	}
+	return ErrorClassOther
 }
 
 func (c CheckerService) AddToQueue(ctx context.Context, entity *entity) error {
@@ -63,57 +172,84 @@ func (c CheckerService) AddToQueue(ctx context.Context, entity *entity) error {
 	return nil
 }
 
-type checkSuccessFunc func(entity *entity) error
+// Requeue queues a proxy which was checked before, its result is not credited to its source again
+func (c CheckerService) Requeue(ctx context.Context, entity *entity) error {
+	queued := *entity
+	queued.Recheck = true
+	return c.AddToQueue(ctx, &queued)
+}
+
+func (c CheckerService) QueueLength(ctx context.Context) (int64, error) {
+	return c.redis.LLen(ctx, queueName).Result()
+}
 
-func (c CheckerService) ProcessQueue(ctx context.Context, successFunc checkSuccessFunc) {
+type checkSuccessFunc func(ctx context.Context, entity *entity) error
+
+type checkFailureFunc func(ctx context.Context, entity *entity) error
+
+// ProcessQueue checks the queued proxies until ctx is done, then waits for the checks in flight.
+// A check does not end with ctx, the check timeout bounds it so its result is stored on shutdown too
+func (c CheckerService) ProcessQueue(ctx context.Context, successFunc checkSuccessFunc, failureFunc checkFailureFunc) {
 	log.Logger.Info("starting process checker queue")
-	messageChannel := make(chan *entity, maxConcurrentCheck)
-	slotChannel := make(chan int, maxConcurrentCheck)
-	go func() {
-	loop:
-		for {
-			select {
-			case <-ctx.Done():
-				break loop
-			case e := <-messageChannel:
-				go func() {
-					if c.Check(e) {
-						err := successFunc(e)
-						if err != nil {
-							log.Logger.Error("failed to process success func", zap.Error(err))
-						}
-					}
-					// release slot
-					<-slotChannel
-				}()
-			}
-		}
-	}()
+	slots := make(chan struct{}, c.concurrency)
+	var checks sync.WaitGroup
 loop:
 	for {
+		// take a slot before polling, so a popped proxy is always checked
 		select {
 		case <-ctx.Done():
 			log.Logger.Info("context ended, stop polling queue")
 			break loop
-		default:
-			result, err := c.redis.BLPop(ctx, time.Second, queueName).Result()
-			if errors.Is(err, redis.Nil) {
-				continue
-			}
-			if err != nil {
+		case slots <- struct{}{}:
+		}
+		result, err := c.redis.BLPop(ctx, time.Second, queueName).Result()
+		if err != nil {
+			<-slots
+			if ctx.Err() == nil && !errors.Is(err, redis.Nil) {
 				log.Logger.Error("polling queue failed", zap.Error(err))
-				break
 			}
-			e := entity{}
-			err = json.Unmarshal([]byte(result[1]), &e)
-			if err != nil {
-				log.Logger.Error("unmarshal queue message failed", zap.Error(err))
-				break
-			}
-			messageChannel <- &e
-			// take a slot to process
-			slotChannel <- 1
+			continue
+		}
+		e := &entity{}
+		err = json.Unmarshal([]byte(result[1]), e)
+		if err != nil {
+			<-slots
+			log.Logger.Error("unmarshal queue message failed", zap.Error(err))
+			continue
 		}
+		checks.Add(1)
+		go func() {
+			defer checks.Done()
+			// release slot
+			defer func() { <-slots }()
+			_, timeout := c.profile.get()
+			checkCtx, cancel := context.WithTimeout(context.Background(), timeout+checkPersistTimeout)
+			defer cancel()
+			c.process(checkCtx, e, successFunc, failureFunc)
+		}()
 	}
+	checks.Wait()
 	log.Logger.Info("stopped process checker queue")
 }
+
+func (c CheckerService) process(ctx context.Context, e *entity, successFunc checkSuccessFunc, failureFunc checkFailureFunc) {
+	result := c.Probe(ctx, e)
+	observeCheck(result)
+	passed := result.Err == nil
+	if !e.Recheck {
+		c.stats.recordCheck(ctx, e.Source, passed)
+	}
+	if passed {
+		e.LastChecked = time.Now().Unix()
+		err := successFunc(ctx, e)
+		if err != nil {
+			log.Logger.Error("failed to process success func", zap.Error(err))
+		}
+	} else {
+		c.events.Publish(ctx, newProxyEvent(EventCheckFailed, e))
+		err := failureFunc(ctx, e)
+		if err != nil {
+			log.Logger.Error("failed to process failure func", zap.Error(err))
+		}
+	}
+}
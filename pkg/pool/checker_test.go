@@ -1,14 +1,19 @@
 package pool
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"proxy-pool/config"
 	"proxy-pool/internal/core"
 	"testing"
+	"time"
 )
 
 func TestCheckerService_Check(t *testing.T) {
-	checkerService := &CheckerService{
-		redis: core.ProvideRedis(core.ProvideConfig()),
-	}
+	cfg := core.ProvideConfig()
+	checkerService := NewCheckerService(cfg, core.ProvideRedis(cfg), nil, nil)
 	result := checkerService.Check(&entity{
 		Ip:       "zproxy.lum-superproxy.io",
 		Port:     22225,
@@ -22,3 +27,170 @@ func TestCheckerService_Check(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCheckerService_Probe(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	_ = closed.Close()
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer auth.Close()
+	authPort := auth.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name   string
+		entity *entity
+		want   ErrorClass
+	}{
+		{"refused", &entity{Ip: "127.0.0.1", Port: closedPort, Type: Http}, ErrorClassRefused},
+		{"proxy auth", &entity{Ip: "127.0.0.1", Port: authPort, Type: Http}, ErrorClassAuth},
+	}
+	checkerService := NewCheckerService(&config.Config{}, nil, nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkerService.Probe(context.Background(), tt.entity)
+			if result.Err == nil || result.Class != tt.want {
+				t.Errorf("Probe() = %v %v, want %v", result.Class, result.Err, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_StartChecker_finishesChecksOnShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(time.Millisecond * 300)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	cfg := &config.Config{
+		Checker: config.CheckerConfig{Url: "http://check.invalid/", Timeout: time.Second * 5, Concurrency: 1},
+	}
+	s := newTestService(t, cfg)
+	e := &entity{Ip: "127.0.0.1", Port: upstream.Listener.Addr().(*net.TCPAddr).Port, Type: Http}
+	err := s.Recheck(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.StartChecker(ctx)
+		close(stopped)
+	}()
+	select {
+	case <-started:
+	case <-time.After(time.Second * 5):
+		t.Fatal("the proxy was not checked")
+	}
+	cancel()
+	<-stopped
+
+	stored, err := s.Get(context.Background(), e.Ip, e.Port)
+	if err != nil {
+		t.Fatalf("proxy which passed during the shutdown was not stored: %v", err)
+	}
+	if stored.LastChecked == 0 {
+		t.Error("LastChecked was not set")
+	}
+}
+
+// waitForEvent returns the first event of type t, other events are skipped
+func waitForEvent(t *testing.T, events <-chan Event, eventType EventType) Event {
+	t.Helper()
+	timeout := time.After(time.Second * 5)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %v event", eventType)
+		}
+	}
+}
+
+func TestService_StartChecker_demotesFailingMembers(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	_ = closed.Close()
+	cfg := &config.Config{
+		Checker: config.CheckerConfig{Url: "http://check.invalid/", Timeout: time.Second, Concurrency: 1},
+	}
+	s := newTestService(t, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	member := &entity{Ip: "127.0.0.1", Port: closedPort, Type: Http}
+	err = s.SaveMany(ctx, []*entity{member})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := s.Subscribe(ctx)
+	err = s.Recheck(ctx, member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.StartChecker(ctx)
+
+	event := waitForEvent(t, events, EventProxyDemoted)
+	if event.Reason != ReasonCheckFailed || event.Proxy.Port != closedPort {
+		t.Errorf("event = %+v, want the member demoted for %v", event, ReasonCheckFailed)
+	}
+}
+
+func TestService_StartChecker_creditsFirstChecks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	cfg := &config.Config{
+		Checker: config.CheckerConfig{Url: "http://check.invalid/", Timeout: time.Second * 5, Concurrency: 1},
+	}
+	s := newTestService(t, cfg)
+	port := upstream.Listener.Addr().(*net.TCPAddr).Port
+	fetched := &entity{Ip: "127.0.0.1", Port: port, Type: Http, Source: "stats-test"}
+	err := s.checkerService.AddToQueue(context.Background(), fetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the expiry, reported failures and the api queue members of the pool again
+	err = s.Recheck(context.Background(), fetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.StartChecker(ctx)
+		close(stopped)
+	}()
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		depth, err := s.checkerService.QueueLength(context.Background())
+		if err == nil && depth == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the queue was not processed")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	cancel()
+	<-stopped
+
+	passed, err := s.statsService.redis.HGet(context.Background(), fetcherStatsKeyPrefix+fetched.Source, "passed").Int()
+	if err != nil || passed != 1 {
+		t.Errorf("passed checks of the source = %v, %v, want only the first check counted", passed, err)
+	}
+}
@@ -0,0 +1,117 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"proxy-pool/pkg/log"
+	"time"
+)
+
+const eventChannel = "pool:events"
+
+type EventType string
+
+const (
+	EventProxyAdded      EventType = "proxy_added"
+	EventProxyRemoved    EventType = "proxy_removed"
+	EventProxySelected   EventType = "proxy_selected"
+	EventLeaseTaken      EventType = "lease_taken"
+	EventCheckFailed     EventType = "check_failed"
+	EventFetcherFinished EventType = "fetcher_finished"
+	// a member of the pool failed a dial, a report or a check but stays until the checks remove it
+	EventProxyDemoted EventType = "proxy_demoted"
+)
+
+// Event describes a change in the pool, it is fanned out to every replica through redis pub/sub.
+// Proxies are named by their address, upstream credentials never leave through events
+type Event struct {
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	Proxy   *Proxy    `json:"proxy,omitempty"`
+	Fetcher string    `json:"fetcher,omitempty"`
+	Count   int       `json:"count,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// reasons attached to EventProxyRemoved and EventProxyDemoted
+const (
+	ReasonDialFailed  = "dial_failed"
+	ReasonManual      = "manual"
+	ReasonReported    = "reported"
+	ReasonCheckFailed = "check_failed"
+	// no passed check within the retention
+	ReasonUnchecked = "unchecked"
+	// not listed by any source within the retention
+	ReasonUnseen = "unseen"
+	// gone from the files of a source in sync mode
+	ReasonRemovedFromSource = "removed_from_source"
+)
+
+func newProxyEvent(t EventType, e *entity) Event {
+	return Event{
+		Type:  t,
+		Time:  time.Now(),
+		Proxy: e.ToProxy().WithoutCredentials(),
+	}
+}
+
+type EventBus struct {
+	redis *redis.Client
+}
+
+func NewEventBus(redis *redis.Client) *EventBus {
+	return &EventBus{redis: redis}
+}
+
+// Publish sends the event to all subscribers, failures are only logged
+// because events must never break the pool operation which emitted them
+func (b EventBus) Publish(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		log.Logger.Error("failed to marshal event", zap.Error(err))
+		return
+	}
+	err = b.redis.Publish(ctx, eventChannel, string(bytes)).Err()
+	if err != nil {
+		log.Logger.Warn("failed to publish event", zap.String("type", string(event.Type)), zap.Error(err))
+	}
+}
+
+// Subscribe streams events until ctx is done
+func (b EventBus) Subscribe(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	pubSub := b.redis.Subscribe(ctx, eventChannel)
+	go func() {
+		defer close(events)
+		defer pubSub.Close()
+		messages := pubSub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				event := Event{}
+				err := json.Unmarshal([]byte(message.Payload), &event)
+				if err != nil {
+					log.Logger.Warn("unmarshal event failed", zap.Error(err))
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
@@ -0,0 +1,37 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventBus_Publish_withoutCredentials(t *testing.T) {
+	bus := NewEventBus(newTestRedis(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := bus.Subscribe(ctx)
+
+	e := &entity{Ip: "1.1.1.1", Port: 8080, Type: Http, Username: "user", Password: "secret"}
+	// the subscription may not be registered yet, the event is published until it arrives
+	var event Event
+	timeout := time.After(time.Second * 5)
+	for event.Type != EventProxyAdded {
+		bus.Publish(ctx, newProxyEvent(EventProxyAdded, e))
+		select {
+		case event = <-events:
+		case <-time.After(time.Millisecond * 50):
+		case <-timeout:
+			t.Fatal("no event")
+		}
+	}
+	if event.Proxy == nil || event.Proxy.Ip != e.Ip || event.Proxy.Port != e.Port {
+		t.Fatalf("event proxy = %+v, want %v:%v", event.Proxy, e.Ip, e.Port)
+	}
+	if event.Proxy.Username != "" || event.Proxy.Password != "" {
+		t.Errorf("event proxy = %+v, want it without credentials", event.Proxy)
+	}
+	if e.Username == "" {
+		t.Error("newProxyEvent() removed the credentials of the entity")
+	}
+}
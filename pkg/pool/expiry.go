@@ -0,0 +1,121 @@
+package pool
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"time"
+)
+
+const defaultExpiryInterval = time.Minute * 10
+
+// ExpiryService evicts proxies which have not passed a check or been listed by a source for too long.
+// Proxies in the pool are checked again well before they would count as unchecked,
+// so only the ones failing their checks are evicted for it
+type ExpiryService struct {
+	cfg        *config.Config
+	repository *repository
+	checker    *CheckerService
+	events     *EventBus
+}
+
+func NewExpiryService(cfg *config.Config, repo *repository, checker *CheckerService, events *EventBus) *ExpiryService {
+	return &ExpiryService{cfg: cfg, repository: repo, checker: checker, events: events}
+}
+
+func (x *ExpiryService) interval() time.Duration {
+	if x.cfg.Expiry.Interval > 0 {
+		return x.cfg.Expiry.Interval
+	}
+	return defaultExpiryInterval
+}
+
+// Start evicts stale proxies every interval until ctx is done, it is a no-op without a retention
+func (x *ExpiryService) Start(ctx context.Context) {
+	if x.cfg.Expiry.Unchecked <= 0 && x.cfg.Expiry.Unseen <= 0 {
+		return
+	}
+	log.Logger.Info("starting proxy expiry",
+		zap.Duration("unchecked", x.cfg.Expiry.Unchecked),
+		zap.Duration("unseen", x.cfg.Expiry.Unseen),
+	)
+	ticker := time.NewTicker(x.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			evicted, err := x.Expire(ctx, time.Now())
+			if err != nil {
+				log.Logger.Error("failed to expire proxies", zap.Error(err))
+			} else if evicted > 0 {
+				log.Logger.Info("expired proxies", zap.Int("count", evicted))
+			}
+		}
+	}
+}
+
+// expiryReason tells why e is stale at now, or returns "" when it may stay
+func (x *ExpiryService) expiryReason(e *entity, now time.Time) string {
+	if x.cfg.Expiry.Unchecked > 0 && e.LastChecked > 0 && now.Sub(time.Unix(e.LastChecked, 0)) > x.cfg.Expiry.Unchecked {
+		return ReasonUnchecked
+	}
+	if x.cfg.Expiry.Unseen > 0 && e.LastSeenInSource > 0 && now.Sub(time.Unix(e.LastSeenInSource, 0)) > x.cfg.Expiry.Unseen {
+		return ReasonUnseen
+	}
+	return ""
+}
+
+// needsRecheck tells whether e should be checked again, half of the unchecked retention leaves
+// a few expiry intervals for the check to pass
+func (x *ExpiryService) needsRecheck(e *entity, now time.Time) bool {
+	return x.cfg.Expiry.Unchecked > 0 && e.LastChecked > 0 && now.Sub(time.Unix(e.LastChecked, 0)) > x.cfg.Expiry.Unchecked/2
+}
+
+// Expire evicts the stale proxies, queues the ones due for a check and drops index entries without a hash.
+// Proxies saved before their times were recorded get the current time, so they are not evicted at once
+func (x *ExpiryService) Expire(ctx context.Context, now time.Time) (int, error) {
+	err := x.repository.removeDangling(ctx)
+	if err != nil {
+		return 0, err
+	}
+	entities, err := x.repository.getAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var unstamped []*entity
+	evicted, rechecks := 0, 0
+	for _, e := range entities {
+		reason := x.expiryReason(e, now)
+		if reason == "" {
+			if e.LastChecked == 0 || e.LastSeenInSource == 0 {
+				unstamped = append(unstamped, e)
+			}
+			if x.needsRecheck(e, now) {
+				rechecks++
+				err = x.checker.Requeue(ctx, e)
+				if err != nil {
+					return evicted, err
+				}
+			}
+			continue
+		}
+		err = x.repository.delete(ctx, e)
+		if err != nil {
+			return evicted, err
+		}
+		evicted++
+		event := newProxyEvent(EventProxyRemoved, e)
+		event.Reason = reason
+		x.events.Publish(ctx, event)
+	}
+	if rechecks > 0 {
+		log.Logger.Info("queued proxies for recheck", zap.Int("count", rechecks))
+	}
+	if len(unstamped) > 0 {
+		err = x.repository.stampMissingTimes(ctx, unstamped, now.Unix())
+	}
+	return evicted, err
+}
@@ -0,0 +1,136 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"proxy-pool/config"
+	"testing"
+	"time"
+)
+
+func TestExpiryService_expiryReason(t *testing.T) {
+	x := NewExpiryService(&config.Config{
+		Expiry: config.ExpiryConfig{
+			Unchecked: time.Hour * 6,
+			Unseen:    time.Hour * 72,
+		},
+	}, nil, nil, nil)
+	now := time.Unix(1700000000, 0)
+	ago := func(d time.Duration) int64 {
+		return now.Add(-d).Unix()
+	}
+	tests := []struct {
+		name string
+		e    *entity
+		want string
+	}{
+		{"fresh", &entity{LastChecked: ago(time.Hour), LastSeenInSource: ago(time.Hour)}, ""},
+		{"unchecked", &entity{LastChecked: ago(time.Hour * 7), LastSeenInSource: ago(time.Hour)}, ReasonUnchecked},
+		{"unseen", &entity{LastChecked: ago(time.Hour), LastSeenInSource: ago(time.Hour * 73)}, ReasonUnseen},
+		{"never recorded", &entity{}, ""},
+	}
+	for _, tt := range tests {
+		if got := x.expiryReason(tt.e, now); got != tt.want {
+			t.Errorf("%v: expiryReason() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpiryService_Expire_keepsPassingProxies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	cfg := &config.Config{
+		Checker: config.CheckerConfig{Url: "http://check.invalid/", Timeout: time.Second * 5, Concurrency: 1},
+		Expiry:  config.ExpiryConfig{Unchecked: time.Hour * 6},
+	}
+	s := newTestService(t, cfg)
+	ctx := context.Background()
+	now := time.Now()
+	port := upstream.Listener.Addr().(*net.TCPAddr).Port
+	err := s.SaveMany(ctx, []*entity{{
+		Ip:               "127.0.0.1",
+		Port:             port,
+		Type:             Http,
+		LastChecked:      now.Add(-time.Hour * 5).Unix(),
+		LastSeenInSource: now.Unix(),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evicted, err := s.expiryService.Expire(ctx, now)
+	if err != nil || evicted != 0 {
+		t.Fatalf("Expire() = %v, %v, want nothing evicted", evicted, err)
+	}
+	if queued, _ := s.checkerService.QueueLength(ctx); queued != 1 {
+		t.Fatalf("queued %v proxies, want the one due for a check", queued)
+	}
+
+	checkerCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		s.StartChecker(checkerCtx)
+		close(stopped)
+	}()
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		e, err := s.Get(ctx, "127.0.0.1", port)
+		if err == nil && e.LastChecked >= now.Unix() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the proxy has not been checked again")
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	cancel()
+	<-stopped
+
+	// past the retention of the first check
+	evicted, err = s.expiryService.Expire(ctx, now.Add(time.Hour*5))
+	if err != nil || evicted != 0 {
+		t.Fatalf("Expire() = %v, %v, want the rechecked proxy kept", evicted, err)
+	}
+	if _, err := s.Get(ctx, "127.0.0.1", port); err != nil {
+		t.Errorf("Get() = %v, want the proxy in the pool", err)
+	}
+}
+
+func TestExpiryService_Expire_leavesNoOrphanHash(t *testing.T) {
+	cfg := &config.Config{Expiry: config.ExpiryConfig{Unseen: time.Hour}}
+	s := newTestService(t, cfg)
+	ctx := context.Background()
+	now := time.Now()
+	unseen := &entity{Ip: "10.0.0.1", Port: 80, Type: Http, LastSeenInSource: now.Add(-time.Hour * 2).Unix()}
+	err := s.SaveMany(ctx, []*entity{unseen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// saving records when the proxy was first seen only
+	err = s.repository.redis.HSet(ctx, buildKeyName(unseen), "last_checked", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evicted, err := s.expiryService.Expire(ctx, now)
+	if err != nil || evicted != 1 {
+		t.Fatalf("Expire() = %v, %v, want the unseen proxy evicted", evicted, err)
+	}
+	if n := s.repository.redis.Exists(ctx, buildKeyName(unseen)).Val(); n != 0 {
+		t.Error("the hash of the evicted proxy has been written again")
+	}
+
+	// a proxy deleted while it is stamped
+	gone := &entity{Ip: "10.0.0.2", Port: 80, Type: Http}
+	err = s.repository.stampMissingTimes(ctx, []*entity{gone}, now.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.repository.redis.Exists(ctx, buildKeyName(gone)).Val(); n != 0 {
+		t.Error("stamping created the hash of a proxy which is not in the pool")
+	}
+}
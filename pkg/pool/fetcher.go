@@ -1,7 +1,9 @@
 package pool
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gocolly/colly/v2"
 	"go.uber.org/zap"
 	"io"
@@ -10,19 +12,37 @@ import (
 	"strconv"
 )
 
+// Fetcher scrapes a proxy source, Get must return once ctx is done.
+// Requests go through httpClient or newCollector so they can be routed through the pool
 type Fetcher interface {
-	Get() ([]*entity, error)
+	Get(ctx context.Context) ([]*entity, error)
 	Name() string
 }
 
+// contextTransport binds the requests of a colly collector to ctx, colly has no context support
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(request.WithContext(t.ctx))
+}
+
+func newCollector(ctx context.Context) *colly.Collector {
+	c := colly.NewCollector()
+	c.WithTransport(contextTransport{ctx: ctx, base: transportFrom(ctx)})
+	return c
+}
+
 type ProxyHubFetcher struct{}
 
 func (p ProxyHubFetcher) Name() string {
 	return "https://www.proxyhub.me"
 }
 
-func (p ProxyHubFetcher) Get() ([]*entity, error) {
-	c := colly.NewCollector()
+func (p ProxyHubFetcher) Get(ctx context.Context) ([]*entity, error) {
+	c := newCollector(ctx)
 
 	var entities []*entity
 	// Find and visit all links
@@ -43,7 +63,7 @@ func (p ProxyHubFetcher) Get() ([]*entity, error) {
 					entity.Port = port
 					break
 				case 2:
-					t, err := parseType(element.Text)
+					t, err := ParseType(element.Text)
 					if err != nil {
 						log.Logger.Error("failed to parse type", zap.Error(err))
 					}
@@ -68,12 +88,19 @@ func (p ProxyHubFetcher) Get() ([]*entity, error) {
 type ProxyScanFetcher struct {
 }
 
-func (p ProxyScanFetcher) Get() ([]*entity, error) {
-	client := http.Client{}
-	resp, err := client.Get("https://www.proxyscan.io/api/proxy?ping=1000&limit=20&uptime=50&last_check=3600&country=vn,th,sg")
+func (p ProxyScanFetcher) Get(ctx context.Context) ([]*entity, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.proxyscan.io/api/proxy?ping=1000&limit=20&uptime=50&last_check=3600&country=vn,th,sg", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(ctx).Do(request)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
 	bytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -85,7 +112,7 @@ func (p ProxyScanFetcher) Get() ([]*entity, error) {
 	}
 	var result []*entity
 	for _, v := range parsed {
-		t, err := parseType((v["Type"].([]interface{}))[0].(string))
+		t, err := ParseType((v["Type"].([]interface{}))[0].(string))
 		if err != nil {
 			return nil, err
 		}
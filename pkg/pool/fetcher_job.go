@@ -2,71 +2,493 @@ package pool
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
+	"proxy-pool/config"
 	"proxy-pool/pkg/log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// fetches asked for through the api, the leader runs them so they never overlap its schedule
+const fetchRequestKey = "queue:fetch"
+
+// used when the config leaves them unset
+const (
+	defaultFetcherSchedule = "50 * * * * *"
+	defaultFetcherTimeout  = time.Minute * 2
+	// time left to store the proxies of a finished fetch once the job is stopped or reloaded
+	fetchPersistTimeout = time.Second * 30
+)
+
+var (
+	ErrFetcherTimeout = errors.New("fetcher timed out")
+	ErrFetcherRunning = errors.New("previous run still in progress")
+	ErrUnknownFetcher = errors.New("unknown fetcher")
+)
+
+// FetchResult describes one fetcher run
+type FetchResult struct {
+	Name  string
+	Count int
+	// proxies repeated within the run or already in the pool, they are not checked again
+	Duplicates int
+	Enqueued   int
+	Duration   time.Duration
+	Err        error
+}
+
+// syncedFetcher is implemented by fetchers whose proxies leave the pool once they stop listing them
+type syncedFetcher interface {
+	Sync() bool
+}
+
+// watchingFetcher is implemented by fetchers which run whenever their source changes
+type watchingFetcher interface {
+	Watch(ctx context.Context, changed func()) error
+}
+
+// scheduledFetcher is a registered fetcher with its settings
+type scheduledFetcher struct {
+	Fetcher
+	schedule   string
+	timeout    time.Duration
+	maxResults int
+	// retries through the pool, 0 fetches directly
+	viaPoolRetries int
+	// set while a run is in progress so runs never overlap, shared by the fetchers of one name across reloads
+	running *int32
+}
+
+// builtinFetchers are registered before the sources, enabled tells whether they run without settings
+var builtinFetchers = []struct {
+	fetcher Fetcher
+	enabled bool
+}{
+	{&ProxyHubFetcher{}, false},
+	{&ProxyScanFetcher{}, true},
+}
+
+// schedule is the running schedule of the fetchers
+type schedule struct {
+	ctx  context.Context
+	stop func()
+}
+
 type FetcherJob struct {
-	fetchers       []Fetcher
+	// guards cfg, the fetchers and the schedule, which change on reload
+	mu         sync.Mutex
+	cfg        *config.Config
+	fetchers   []*scheduledFetcher
+	registered bool
+	scheduled  *schedule
+	// run guards by fetcher name, kept across reloads
+	running        map[string]*int32
+	repository     *repository
 	checkerService *CheckerService
+	events         *EventBus
+	stats          *StatsService
+	// every run derives from ctx, Stop cancels it
+	ctx    context.Context
+	cancel context.CancelFunc
+	// running schedules and request pollers, Stop waits for them
+	setups sync.WaitGroup
 }
 
-func NewFetcherJob(service *CheckerService) *FetcherJob {
+func NewFetcherJob(cfg *config.Config, repo *repository, service *CheckerService, events *EventBus, stats *StatsService) *FetcherJob {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &FetcherJob{
+		cfg:            cfg,
+		repository:     repo,
 		checkerService: service,
+		events:         events,
+		stats:          stats,
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 }
 
-func (f *FetcherJob) RegisterFetcher(fetcher Fetcher) {
+func newScheduler() *cron.Cron {
+	return cron.New(cron.WithParser(config.ScheduleParser))
+}
+
+// RegisterFetcher adds the fetcher unless its settings disable it
+func (f *FetcherJob) RegisterFetcher(fetcher Fetcher, settings config.FetcherConfig) {
+	if settings.Enabled != nil && !*settings.Enabled {
+		log.Logger.Info("fetcher disabled: " + fetcher.Name())
+		return
+	}
 	log.Logger.Info("register fetcher: " + fetcher.Name())
-	f.fetchers = append(f.fetchers, fetcher)
+	if f.running == nil {
+		f.running = map[string]*int32{}
+	}
+	// a run of the fetcher replaced by a reload may still be storing its results
+	if f.running[fetcher.Name()] == nil {
+		f.running[fetcher.Name()] = new(int32)
+	}
+	s := &scheduledFetcher{
+		Fetcher:    fetcher,
+		schedule:   settings.Schedule,
+		timeout:    settings.Timeout,
+		maxResults: settings.MaxResults,
+		running:    f.running[fetcher.Name()],
+	}
+	if synced, ok := fetcher.(syncedFetcher); ok && synced.Sync() {
+		// a truncated run would remove the proxies left out
+		s.maxResults = 0
+	}
+	if settings.ViaPool {
+		s.viaPoolRetries = settings.ViaPoolRetries
+		if s.viaPoolRetries <= 0 {
+			s.viaPoolRetries = defaultViaPoolRetries
+		}
+	}
+	if s.schedule == "" {
+		s.schedule = f.cfg.Fetcher.Schedule
+	}
+	if s.schedule == "" {
+		s.schedule = defaultFetcherSchedule
+	}
+	if s.timeout <= 0 {
+		s.timeout = f.cfg.Fetcher.Timeout
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultFetcherTimeout
+	}
+	f.fetchers = append(f.fetchers, s)
 }
 
-func (f *FetcherJob) ProcessFetcher(ctx context.Context, fetcher Fetcher, group *sync.WaitGroup) {
-	entities, err := fetcher.Get()
+// fetch runs the fetcher with its deadline
+func (f *FetcherJob) fetch(ctx context.Context, fetcher *scheduledFetcher) ([]*entity, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetcher.timeout)
+	defer cancel()
+	if fetcher.viaPoolRetries > 0 {
+		ctx = withTransport(ctx, poolTransport{repository: f.repository, attempts: fetcher.viaPoolRetries + 1})
+	}
+	entities, err := fetcher.Get(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ErrFetcherTimeout
+	}
+	if fetcher.maxResults > 0 && len(entities) > fetcher.maxResults {
+		entities = entities[:fetcher.maxResults]
+	}
+	return entities, err
+}
+
+func (f *FetcherJob) processFetcher(ctx context.Context, fetcher *scheduledFetcher) FetchResult {
+	result := FetchResult{Name: fetcher.Name()}
+	if !atomic.CompareAndSwapInt32(fetcher.running, 0, 1) {
+		log.Logger.Info("skipping fetcher, previous run still in progress", zap.String("name", fetcher.Name()))
+		result.Err = ErrFetcherRunning
+		return result
+	}
+	defer atomic.StoreInt32(fetcher.running, 0)
+	start := time.Now()
+	entities, err := f.fetch(ctx, fetcher)
+	result.Count, result.Duration, result.Err = len(entities), time.Since(start), err
+	// the fetched proxies are stored even when ctx is cancelled meanwhile
+	ctx, cancel := context.WithTimeout(context.Background(), fetchPersistTimeout)
+	defer cancel()
 	if err != nil {
 		log.Logger.Error("failed to process fetcher", zap.String("name", fetcher.Name()), zap.Error(err))
+	} else if synced, ok := fetcher.Fetcher.(syncedFetcher); ok && synced.Sync() {
+		err = f.removeUnlisted(ctx, fetcher.Name(), entities)
+		if err != nil {
+			log.Logger.Error("failed to sync source", zap.String("name", fetcher.Name()), zap.Error(err))
+		}
+	}
+	event := Event{
+		Type:    EventFetcherFinished,
+		Fetcher: fetcher.Name(),
+		Count:   len(entities),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	f.events.Publish(ctx, event)
+	fresh, known := f.withoutDuplicates(ctx, entities)
+	result.Duplicates = len(entities) - len(fresh)
+	if len(known) > 0 {
+		err = f.repository.markSeen(ctx, known, fetcher.Name())
+		if err != nil {
+			log.Logger.Warn("failed to update proxies seen again", zap.String("name", fetcher.Name()), zap.Error(err))
+		}
 	}
-	for _, v := range entities {
+	now := time.Now().Unix()
+	for _, v := range fresh {
+		v.Source = fetcher.Name()
+		v.FirstSeen, v.LastSeenInSource = now, now
 		err = f.checkerService.AddToQueue(ctx, v)
 		if err != nil {
 			log.Logger.Error("failed to enqueue checker", zap.Error(err))
+			continue
 		}
+		result.Enqueued++
+	}
+	f.stats.recordFetcherRun(ctx, result)
+	observeFetcherRun(result)
+	log.Logger.Info("finish fetcher job", zap.String("name", fetcher.Name()), zap.Duration("duration", result.Duration))
+	return result
+}
+
+// removeUnlisted removes the proxies of source which are not in listed, proxies other sources
+// still list only lose the source
+func (f *FetcherJob) removeUnlisted(ctx context.Context, source string, listed []*entity) error {
+	keep := map[string]bool{}
+	for _, e := range listed {
+		keep[buildKeyName(e)] = true
 	}
+	entities, err := f.repository.getAll(ctx)
 	if err != nil {
-		log.Logger.Error("failed to process fetcher", zap.String("name", fetcher.Name()), zap.Error(err))
+		return err
 	}
-	log.Logger.Info("finish fetcher job", zap.String("name", fetcher.Name()))
-	group.Done()
+	for _, e := range entities {
+		if keep[buildKeyName(e)] || !e.hasSource(source) {
+			continue
+		}
+		others := make([]string, 0, len(e.Sources))
+		for _, s := range e.Sources {
+			if s != source {
+				others = append(others, s)
+			}
+		}
+		if len(others) > 0 {
+			err = f.repository.setSources(ctx, e, others)
+		} else {
+			err = f.repository.delete(ctx, e)
+			if err == nil {
+				event := newProxyEvent(EventProxyRemoved, e)
+				event.Reason = ReasonRemovedFromSource
+				f.events.Publish(ctx, event)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutDuplicates drops proxies repeated within entities, the ones already in the pool are returned as known
+func (f *FetcherJob) withoutDuplicates(ctx context.Context, entities []*entity) (fresh []*entity, known []*entity) {
+	seen := map[string]bool{}
+	unique := make([]*entity, 0, len(entities))
+	for _, e := range entities {
+		key := buildKeyName(e)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, e)
+		}
+	}
+	exists, err := f.repository.exists(ctx, unique)
+	if err != nil {
+		log.Logger.Warn("failed to look up fetched proxies in the pool", zap.Error(err))
+		return unique, nil
+	}
+	for i, e := range unique {
+		// gateways are checked again on every run, which also saves changes of their settings
+		if exists[i] && !e.isGateway() {
+			known = append(known, e)
+		} else {
+			fresh = append(fresh, e)
+		}
+	}
+	return fresh, known
+}
+
+// settingsOf returns the configured settings of a built-in fetcher
+func (f *FetcherJob) settingsOf(name string, enabled bool) config.FetcherConfig {
+	for _, settings := range f.cfg.Fetchers {
+		if settings.Name == name {
+			if settings.Enabled == nil {
+				settings.Enabled = &enabled
+			}
+			return settings
+		}
+	}
+	return config.FetcherConfig{Name: name, Enabled: &enabled}
 }
 
-func (f *FetcherJob) Start() {
+// registerFetchers registers the built-in fetchers and the sources of the config once
+func (f *FetcherJob) registerFetchers() []*scheduledFetcher {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.registered {
+		f.registered = true
+		for _, builtin := range builtinFetchers {
+			f.RegisterFetcher(builtin.fetcher, f.settingsOf(builtin.fetcher.Name(), builtin.enabled))
+		}
+		for _, source := range f.cfg.Sources {
+			fetcher, err := newSourceFetcher(source)
+			if err != nil {
+				log.Logger.Error("skipping source", zap.Error(err))
+				continue
+			}
+			f.RegisterFetcher(fetcher, source.FetcherConfig)
+		}
+		log.Logger.Info("fetcher count", zap.Int("count", len(f.fetchers)))
+	}
+	return f.fetchers
+}
+
+// Start runs every fetcher once regardless of its schedule
+func (f *FetcherJob) Start() []FetchResult {
+	return f.runAll(f.ctx)
+}
+
+func (f *FetcherJob) runAll(ctx context.Context) []FetchResult {
+	fetchers := f.registerFetchers()
 	log.Logger.Info("starting process fetcher job")
-	ctx := context.Background()
+	results := make([]FetchResult, len(fetchers))
 	var group sync.WaitGroup
-	group.Add(len(f.fetchers))
-	for _, fetcher := range f.fetchers {
-		go f.ProcessFetcher(ctx, fetcher, &group)
+	group.Add(len(fetchers))
+	for i, fetcher := range fetchers {
+		go func(i int, fetcher *scheduledFetcher) {
+			defer group.Done()
+			results[i] = f.processFetcher(ctx, fetcher)
+		}(i, fetcher)
 	}
 	group.Wait()
 	log.Logger.Info("finished all fetcher jobs")
+	return results
 }
 
-func (f *FetcherJob) Setup() {
-	log.Logger.Info("setting up fetcher cron job")
-	//f.RegisterFetcher(&ProxyHubFetcher{})
-	f.RegisterFetcher(&ProxyScanFetcher{})
-	log.Logger.Info("fetcher count", zap.Int("count", len(f.fetchers)))
-	c := cron.New(cron.WithParser(cron.NewParser(
-		cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
-	)))
-	_, err := c.AddFunc("50 * * * * *", func() {
-		f.Start()
-	})
-	if err != nil {
-		log.Logger.Error("failed to setup cron job", zap.Error(err))
+// RequestFetch asks the leader to run every fetcher once
+func (f *FetcherJob) RequestFetch(ctx context.Context) error {
+	return f.repository.redis.RPush(ctx, fetchRequestKey, time.Now().Unix()).Err()
+}
+
+// serveRequests runs the fetches asked for through RequestFetch in the background until ctx is done,
+// requests made while a run is in progress are served by one more run. Stop waits for it
+func (f *FetcherJob) serveRequests(ctx context.Context) {
+	f.setups.Add(1)
+	go func() {
+		defer f.setups.Done()
+		f.pollRequests(ctx)
+	}()
+}
+
+func (f *FetcherJob) pollRequests(ctx context.Context) {
+	for {
+		_, err := f.repository.redis.BLPop(ctx, time.Second, fetchRequestKey).Result()
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			log.Logger.Warn("polling fetch requests failed", zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		// the requests queued meanwhile ask for the same run
+		err = f.repository.redis.Del(ctx, fetchRequestKey).Err()
+		if err != nil {
+			log.Logger.Warn("failed to clear fetch requests", zap.Error(err))
+		}
+		log.Logger.Info("running requested fetch")
+		f.runAll(ctx)
+	}
+}
+
+// Run runs the named fetcher once, or every fetcher when name is empty
+func (f *FetcherJob) Run(name string) ([]FetchResult, error) {
+	if name == "" {
+		return f.Start(), nil
+	}
+	for _, fetcher := range f.registerFetchers() {
+		if fetcher.Name() == name {
+			return []FetchResult{f.processFetcher(f.ctx, fetcher)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownFetcher, name)
+}
+
+// schedule starts the cron entries and watchers of fetchers, stop cancels their runs
+// and waits for the scheduled ones to return
+func (f *FetcherJob) schedule(ctx context.Context, fetchers []*scheduledFetcher) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	scheduler := newScheduler()
+	for _, fetcher := range fetchers {
+		fetcher := fetcher
+		_, err := scheduler.AddFunc(fetcher.schedule, func() {
+			f.processFetcher(ctx, fetcher)
+		})
+		if err != nil {
+			log.Logger.Error("failed to setup cron job", zap.String("name", fetcher.Name()), zap.Error(err))
+		}
+		if watching, ok := fetcher.Fetcher.(watchingFetcher); ok {
+			go func() {
+				err := watching.Watch(ctx, func() {
+					f.processFetcher(ctx, fetcher)
+				})
+				if err != nil {
+					log.Logger.Error("failed to watch source", zap.String("name", fetcher.Name()), zap.Error(err))
+				}
+			}()
+		}
+	}
+	scheduler.Start()
+	return func() {
+		cancel()
+		<-scheduler.Stop().Done()
 	}
-	c.Start()
+}
+
+// Setup schedules each fetcher on its own, so a slow source never delays the others.
+// The schedules stop and in-flight fetches are cancelled once ctx is done or the job is stopped,
+// a later Setup schedules them again
+func (f *FetcherJob) Setup(ctx context.Context) {
+	log.Logger.Info("setting up fetcher cron jobs")
+	fetchers := f.registerFetchers()
+	scheduled := &schedule{ctx: ctx, stop: f.schedule(ctx, fetchers)}
+	f.mu.Lock()
+	f.scheduled = scheduled
+	f.mu.Unlock()
+	f.setups.Add(1)
+	go func() {
+		defer f.setups.Done()
+		select {
+		case <-ctx.Done():
+		case <-f.ctx.Done():
+		}
+		// Reload swaps the stop of the schedule under the lock
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		scheduled.stop()
+		// a later Setup has replaced the schedule, which keeps running
+		if f.scheduled == scheduled {
+			f.scheduled = nil
+		}
+	}()
+}
+
+// Reload replaces the fetchers with the ones of cfg. Scheduled fetchers are rescheduled,
+// their in-flight runs are cancelled
+func (f *FetcherJob) Reload(cfg *config.Config) {
+	f.mu.Lock()
+	f.cfg, f.fetchers, f.registered = cfg, nil, false
+	f.mu.Unlock()
+	fetchers := f.registerFetchers()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.scheduled != nil {
+		f.scheduled.stop()
+		f.scheduled.stop = f.schedule(f.scheduled.ctx, fetchers)
+	}
+}
+
+// Stop cancels in-flight fetches and waits for the scheduled runs to return
+func (f *FetcherJob) Stop() {
+	f.cancel()
+	f.setups.Wait()
 }
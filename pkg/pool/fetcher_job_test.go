@@ -0,0 +1,239 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"proxy-pool/config"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeFetcher struct {
+	delay    time.Duration
+	entities []*entity
+}
+
+func (f fakeFetcher) Name() string {
+	return "fake"
+}
+
+func (f fakeFetcher) Get(ctx context.Context) ([]*entity, error) {
+	select {
+	case <-time.After(f.delay):
+		return f.entities, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestFetcherJob_fetch(t *testing.T) {
+	job := &FetcherJob{}
+	entities := []*entity{{Ip: "1.1.1.1", Port: 80}, {Ip: "2.2.2.2", Port: 80}, {Ip: "3.3.3.3", Port: 80}}
+
+	got, err := job.fetch(context.Background(), &scheduledFetcher{
+		Fetcher:    fakeFetcher{entities: entities},
+		timeout:    time.Second,
+		maxResults: 2,
+	})
+	if err != nil || len(got) != 2 {
+		t.Errorf("fetch() = %v, %v, want 2 entities", got, err)
+	}
+
+	_, err = job.fetch(context.Background(), &scheduledFetcher{
+		Fetcher: fakeFetcher{delay: time.Second, entities: entities},
+		timeout: time.Millisecond * 10,
+	})
+	if !errors.Is(err, ErrFetcherTimeout) {
+		t.Errorf("fetch() error = %v, want %v", err, ErrFetcherTimeout)
+	}
+}
+
+func TestFetcherJob_Setup(t *testing.T) {
+	job := NewFetcherJob(&config.Config{}, nil, nil, nil, nil)
+	job.registered = true
+	defer job.Stop()
+	scheduled := func() *schedule {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		return job.scheduled
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	job.Setup(first)
+	second, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	job.Setup(second)
+
+	// stopping the first schedule leaves the second one running
+	cancelFirst()
+	time.Sleep(time.Millisecond * 50)
+	if s := scheduled(); s == nil || s.ctx != second {
+		t.Fatalf("scheduled = %+v, want the second schedule", s)
+	}
+
+	cancelSecond()
+	deadline := time.Now().Add(time.Second)
+	for scheduled() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("schedule was not cleared once its context was done")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// stoppingFetcher returns its proxies after the job was stopped during the fetch
+type stoppingFetcher struct {
+	stop     func()
+	entities []*entity
+}
+
+func (f stoppingFetcher) Name() string {
+	return "stopping"
+}
+
+func (f stoppingFetcher) Get(ctx context.Context) ([]*entity, error) {
+	f.stop()
+	<-ctx.Done()
+	return f.entities, nil
+}
+
+func TestFetcherJob_processFetcher_stopped(t *testing.T) {
+	cfg := &config.Config{}
+	client := newTestRedis(t)
+	events := NewEventBus(client)
+	stats := NewStatsService(client)
+	checker := NewCheckerService(cfg, client, events, stats)
+	job := NewFetcherJob(cfg, NewRepository(client), checker, events, stats)
+	entities := []*entity{{Ip: "1.1.1.1", Port: 80, Type: Http}, {Ip: "2.2.2.2", Port: 80, Type: Http}}
+
+	result := job.processFetcher(job.ctx, &scheduledFetcher{
+		Fetcher: stoppingFetcher{stop: job.Stop, entities: entities},
+		timeout: time.Second,
+		running: new(int32),
+	})
+	if result.Enqueued != len(entities) {
+		t.Errorf("Enqueued = %v, want %v", result.Enqueued, len(entities))
+	}
+	depth, err := checker.QueueLength(context.Background())
+	if err != nil || depth != int64(len(entities)) {
+		t.Errorf("QueueLength() = %v, %v, want %v", depth, err, len(entities))
+	}
+}
+
+// transportFetcher records the transport its requests would use
+type transportFetcher struct {
+	transport *http.RoundTripper
+}
+
+func (f transportFetcher) Name() string {
+	return "transport"
+}
+
+func (f transportFetcher) Get(ctx context.Context) ([]*entity, error) {
+	*f.transport = transportFrom(ctx)
+	return nil, nil
+}
+
+func TestFetcherJob_fetch_viaPool(t *testing.T) {
+	job := &FetcherJob{}
+	var transport http.RoundTripper
+	_, err := job.fetch(context.Background(), &scheduledFetcher{
+		Fetcher:        transportFetcher{transport: &transport},
+		timeout:        time.Second,
+		viaPoolRetries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one retry after the first upstream
+	if pool, ok := transport.(poolTransport); !ok || pool.attempts != 2 {
+		t.Errorf("transport = %#v, want 2 attempts through the pool", transport)
+	}
+}
+
+func TestFetcherJob_Reload_keepsRunGuard(t *testing.T) {
+	job := NewFetcherJob(&config.Config{}, nil, nil, nil, nil)
+	defer job.Stop()
+	fetchers := job.registerFetchers()
+	if len(fetchers) == 0 {
+		t.Fatal("no fetcher registered")
+	}
+	// a run started before the reload is still storing its results
+	atomic.StoreInt32(fetchers[0].running, 1)
+
+	job.Reload(&config.Config{})
+	for _, fetcher := range job.registerFetchers() {
+		if fetcher.Name() != fetchers[0].Name() {
+			continue
+		}
+		if fetcher == fetchers[0] {
+			t.Fatal("Reload() kept the fetcher, want a new one")
+		}
+		result := job.processFetcher(job.ctx, fetcher)
+		if !errors.Is(result.Err, ErrFetcherRunning) {
+			t.Errorf("processFetcher() during the run error = %v, want %v", result.Err, ErrFetcherRunning)
+		}
+		return
+	}
+	t.Fatalf("%v was not registered again", fetchers[0].Name())
+}
+
+// countingFetcher counts its runs
+type countingFetcher struct {
+	runs *int32
+}
+
+func (f countingFetcher) Name() string {
+	return "counting"
+}
+
+func (f countingFetcher) Get(ctx context.Context) ([]*entity, error) {
+	atomic.AddInt32(f.runs, 1)
+	return nil, nil
+}
+
+func TestFetcherJob_serveRequests(t *testing.T) {
+	cfg := &config.Config{}
+	client := newTestRedis(t)
+	events := NewEventBus(client)
+	stats := NewStatsService(client)
+	job := NewFetcherJob(cfg, NewRepository(client), NewCheckerService(cfg, client, events, stats), events, stats)
+	var runs int32
+	job.registered = true
+	job.fetchers = []*scheduledFetcher{{Fetcher: countingFetcher{runs: &runs}, timeout: time.Second, running: new(int32)}}
+	waitForRuns := func(want int32) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second * 5)
+		for atomic.LoadInt32(&runs) < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("runs = %v, want %v", atomic.LoadInt32(&runs), want)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		time.Sleep(time.Millisecond * 100)
+		if got := atomic.LoadInt32(&runs); got != want {
+			t.Fatalf("runs = %v, want %v", got, want)
+		}
+	}
+
+	// requests made before the leader polls share one run
+	for i := 0; i < 3; i++ {
+		err := job.RequestFetch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job.serveRequests(ctx)
+	waitForRuns(1)
+
+	err := job.RequestFetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForRuns(2)
+	cancel()
+	job.Stop()
+}
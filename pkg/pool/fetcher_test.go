@@ -1,10 +1,13 @@
 package pool
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestProxyHubFetcher_Get(t *testing.T) {
 	fetcher := new(ProxyHubFetcher)
-	get, err := fetcher.Get()
+	get, err := fetcher.Get(context.Background())
 	if err != nil {
 		t.Error(err)
 	} else {
@@ -17,7 +20,7 @@ func TestProxyHubFetcher_Get(t *testing.T) {
 
 func TestProxyScanFetcher_Get(t *testing.T) {
 	fetcher := new(ProxyScanFetcher)
-	get, err := fetcher.Get()
+	get, err := fetcher.Get(context.Background())
 	if err != nil {
 		t.Error(err)
 	} else {
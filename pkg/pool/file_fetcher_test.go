@@ -0,0 +1,142 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"proxy-pool/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileFetcher_Get(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":  "# vendor a\nsocks5://u:p@1.1.1.1:1080\n2.2.2.2:8080\n\nproxy.example.com:3128:user:pass\n",
+		"b.csv":  "host,port,type,country\n3.3.3.3,80,https,VN\n",
+		"c.json": `[{"ip":"4.4.4.4","port":80}]`,
+		"d.md":   "not matched",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetcher, err := NewFileFetcher(config.SourceConfig{
+		FetcherConfig: config.FetcherConfig{Name: "vendor"},
+		Parser:        ParserFile,
+		Paths:         []string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "*.csv"), filepath.Join(dir, "*.json")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fetcher.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*entity{
+		{Ip: "1.1.1.1", Port: 1080, Type: Socks5, Username: "u", Password: "p"},
+		{Ip: "2.2.2.2", Port: 8080, Type: Http},
+		{Ip: "proxy.example.com", Port: 3128, Type: Http, Username: "user", Password: "pass"},
+		{Ip: "3.3.3.3", Port: 80, Type: Https, Country: "VN"},
+		{Ip: "4.4.4.4", Port: 80, Type: Http},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+}
+
+func TestFileFetcher_Get_skipsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":  "1.1.1.1\n2.2.2.2:8080:user:pa:ss\nnot a proxy\n[::1]:3128\n",
+		"b.csv":  "host,port\n3.3.3.3,80\n3.3.3.4,port\n3.3.3.5,\"80\n",
+		"c.json": `[{"ip":"4.4.4.4","port":80},{"ip":"4.4.4.5","port":0},{"ip":"4.4.4.6","port":80,"type":"ftp"}]`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetcher, err := NewFileFetcher(config.SourceConfig{
+		FetcherConfig: config.FetcherConfig{Name: "vendor"},
+		Parser:        ParserFile,
+		Paths:         []string{filepath.Join(dir, "*")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fetcher.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get() error = %v, want the invalid entries skipped", err)
+	}
+	want := []*entity{
+		{Ip: "2.2.2.2", Port: 8080, Type: Http, Username: "user", Password: "pa:ss"},
+		{Ip: "::1", Port: 3128, Type: Http},
+		{Ip: "3.3.3.3", Port: 80, Type: Http},
+		{Ip: "4.4.4.4", Port: 80, Type: Http},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+}
+
+func TestFileFetcher_Get_noFiles(t *testing.T) {
+	source := config.SourceConfig{
+		FetcherConfig: config.FetcherConfig{Name: "vendor"},
+		Parser:        ParserFile,
+		Paths:         []string{filepath.Join(t.TempDir(), "*.txt")},
+	}
+	fetcher, err := NewFileFetcher(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fetcher.Get(context.Background())
+	if err != nil || len(got) != 0 {
+		t.Errorf("Get() = %v %v, want an empty list", got, err)
+	}
+
+	source.Sync = true
+	fetcher, err = NewFileFetcher(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fetcher.Get(context.Background())
+	if !errors.Is(err, ErrNoFiles) {
+		t.Errorf("Get() of a synced source error = %v, want %v", err, ErrNoFiles)
+	}
+}
+
+func TestFileFetcher_Watch(t *testing.T) {
+	dir := t.TempDir()
+	fetcher, err := NewFileFetcher(config.SourceConfig{
+		FetcherConfig: config.FetcherConfig{Name: "vendor"},
+		Parser:        ParserFile,
+		Paths:         []string{filepath.Join(dir, "*.txt")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan bool, 1)
+	go func() {
+		_ = fetcher.Watch(ctx, func() {
+			changed <- true
+		})
+	}()
+	time.Sleep(time.Millisecond * 100)
+	if err := os.WriteFile(filepath.Join(dir, "ignored.csv"), []byte("ip,port"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte("1.1.1.1:80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(fileWatchDelay * 5):
+		t.Error("Watch() did not report the new file")
+	}
+}
@@ -0,0 +1,265 @@
+package pool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net"
+	"proxy-pool/config"
+	"strconv"
+	"strings"
+)
+
+const (
+	ParserGateway = "gateway"
+
+	defaultGatewaySessions = 10
+	sessionPlaceholder     = "{session}"
+	countryPlaceholder     = "{country}"
+)
+
+// GatewayFetcher adds a rotating backconnect gateway as a single entity.
+// The entity is checked as one endpoint and stands for sessions exits per country when proxies are selected
+type GatewayFetcher struct {
+	source config.SourceConfig
+	host   string
+	port   int
+	t      Type
+}
+
+func NewGatewayFetcher(source config.SourceConfig) (*GatewayFetcher, error) {
+	if source.Name == "" || source.Gateway == "" {
+		return nil, fmt.Errorf("%w: name and gateway are required", ErrInvalidSource)
+	}
+	host, p, err := net.SplitHostPort(source.Gateway)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v: %v", ErrInvalidSource, source.Name, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v: invalid port %q", ErrInvalidSource, source.Name, p)
+	}
+	if len(source.Countries) > 0 && !strings.Contains(source.Username, countryPlaceholder) {
+		return nil, fmt.Errorf("%w %v: countries need %v in the username", ErrInvalidSource, source.Name, countryPlaceholder)
+	}
+	g := &GatewayFetcher{source: source, host: host, port: port, t: Http}
+	if source.Type != "" {
+		g.t, err = ParseType(source.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%w %v: %v", ErrInvalidSource, source.Name, err)
+		}
+	}
+	return g, nil
+}
+
+func (g GatewayFetcher) Name() string {
+	return g.source.Name
+}
+
+func (g GatewayFetcher) Get(_ context.Context) ([]*entity, error) {
+	sessions := g.source.Sessions
+	if sessions <= 0 {
+		sessions = defaultGatewaySessions
+	}
+	return []*entity{{
+		Ip:        g.host,
+		Port:      g.port,
+		Type:      g.t,
+		Username:  g.source.Username,
+		Password:  g.source.Password,
+		Sessions:  sessions,
+		Countries: g.source.Countries,
+	}}, nil
+}
+
+func (e *entity) isGateway() bool {
+	return e.Sessions > 0
+}
+
+// exit is the logical upstream of a gateway for one session slot and country
+func (e *entity) exit(slot int, country string) *entity {
+	exit := *e
+	exit.Sessions = 0
+	exit.Countries = nil
+	exit.Country = country
+	exit.session = sessionId(buildKeyName(e), slot, country)
+	exit.Username = strings.NewReplacer(
+		sessionPlaceholder, exit.session,
+		countryPlaceholder, strings.ToLower(country),
+	).Replace(e.Username)
+	return &exit
+}
+
+// exits lists every logical upstream of a gateway, other entities stand for themselves
+func (e *entity) exits() []*entity {
+	if !e.isGateway() {
+		return []*entity{e}
+	}
+	countries := e.Countries
+	if len(countries) == 0 {
+		countries = []string{e.Country}
+	}
+	exits := make([]*entity, 0, e.Sessions*len(countries))
+	for _, country := range countries {
+		for slot := 0; slot < e.Sessions; slot++ {
+			exits = append(exits, e.exit(slot, country))
+		}
+	}
+	return exits
+}
+
+// randomExit picks one logical upstream, the checker uses it to test a gateway
+func (e *entity) randomExit() *entity {
+	if !e.isGateway() {
+		return e
+	}
+	country := e.Country
+	if len(e.Countries) > 0 {
+		country = e.Countries[rand.Intn(len(e.Countries))]
+	}
+	return e.exit(rand.Intn(e.Sessions), country)
+}
+
+// exitCount is the number of logical upstreams an entity stands for
+func (e *entity) exitCount() int64 {
+	if !e.isGateway() {
+		return 1
+	}
+	countries := len(e.Countries)
+	if countries == 0 {
+		countries = 1
+	}
+	return int64(e.Sessions * countries)
+}
+
+// getRandomExits returns up to count distinct random upstreams the way clients use them.
+// Every exit of a gateway weighs as much as a single proxy
+func (r repository) getRandomExits(ctx context.Context, count int64) ([]*entity, error) {
+	gatewayKeys, err := r.redis.SMembers(ctx, gatewayIndexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	gateways, err := r.getMany(ctx, gatewayKeys)
+	if err != nil {
+		return nil, err
+	}
+	size, err := r.redis.SCard(ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	proxies := size - int64(len(gatewayKeys))
+	if proxies < 0 {
+		proxies = 0
+	}
+	var exits int64
+	for _, g := range gateways {
+		exits += g.exitCount()
+	}
+
+	// split the picks between proxies and gateway exits like drawing without replacement
+	var fromProxies, fromExits int64
+	for remainingProxies, remainingExits := proxies, exits; fromProxies+fromExits < count && remainingProxies+remainingExits > 0; {
+		if rand.Int63n(remainingProxies+remainingExits) < remainingProxies {
+			fromProxies++
+			remainingProxies--
+		} else {
+			fromExits++
+			remainingExits--
+		}
+	}
+
+	candidates, err := r.getRandomProxies(ctx, fromProxies, gatewayKeys)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, randomGatewayExits(gateways, exits, fromExits)...)
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates, nil
+}
+
+// getRandomProxies returns up to count distinct random members of the index which are no indexed gateway
+func (r repository) getRandomProxies(ctx context.Context, count int64, gatewayKeys []string) ([]*entity, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	keys, err := r.redis.SRandMemberN(ctx, indexKey, count+int64(len(gatewayKeys))).Result()
+	if err != nil {
+		return nil, err
+	}
+	isGateway := make(map[string]bool, len(gatewayKeys))
+	for _, k := range gatewayKeys {
+		isGateway[k] = true
+	}
+	proxyKeys := make([]string, 0, count)
+	for _, k := range keys {
+		if !isGateway[k] && int64(len(proxyKeys)) < count {
+			proxyKeys = append(proxyKeys, k)
+		}
+	}
+	entities, err := r.getMany(ctx, proxyKeys)
+	if err != nil {
+		return nil, err
+	}
+	// a gateway saved before the gateway index existed still goes out through one of its exits
+	for i, e := range entities {
+		entities[i] = e.randomExit()
+	}
+	return entities, nil
+}
+
+// randomGatewayExits picks count distinct exits, a gateway is picked in proportion to its exits
+func randomGatewayExits(gateways []*entity, total int64, count int64) []*entity {
+	if count == 0 {
+		return nil
+	}
+	// rejecting repeated slots gets slow when most of them are wanted, shuffle them all instead
+	if count*4 >= total {
+		var all []*entity
+		for _, g := range gateways {
+			all = append(all, g.exits()...)
+		}
+		rand.Shuffle(len(all), func(i, j int) {
+			all[i], all[j] = all[j], all[i]
+		})
+		if int64(len(all)) > count {
+			all = all[:count]
+		}
+		return all
+	}
+	picked := make(map[string]bool, count)
+	exits := make([]*entity, 0, count)
+	for int64(len(exits)) < count {
+		n := rand.Int63n(total)
+		for _, g := range gateways {
+			if n >= g.exitCount() {
+				n -= g.exitCount()
+				continue
+			}
+			exit := g.randomExit()
+			if !picked[leaseKeyName(exit)] {
+				picked[leaseKeyName(exit)] = true
+				exits = append(exits, exit)
+			}
+			break
+		}
+	}
+	return exits
+}
+
+// sessionId is stable for a slot, so a slot keeps its exit as long as the provider keeps the session
+func sessionId(key string, slot int, country string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v/%v/%v", key, country, slot)))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// leaseKeyName tells the exits of a gateway apart, they share the address of the gateway
+func leaseKeyName(e *entity) string {
+	if e.session != "" {
+		return buildKeyName(e) + ":" + e.session
+	}
+	return buildKeyName(e)
+}
@@ -0,0 +1,133 @@
+package pool
+
+import (
+	"context"
+	"proxy-pool/config"
+	"testing"
+)
+
+func TestGatewayFetcher_exits(t *testing.T) {
+	fetcher, err := NewGatewayFetcher(config.SourceConfig{
+		FetcherConfig: config.FetcherConfig{Name: "gateway"},
+		Parser:        ParserGateway,
+		Gateway:       "gw.example.com:22225",
+		Username:      "customer-x-country-{country}-session-{session}",
+		Password:      "secret",
+		Countries:     []string{"VN", "TH"},
+		Sessions:      3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entities, _ := fetcher.Get(context.Background())
+	if len(entities) != 1 || !entities[0].isGateway() {
+		t.Fatalf("Get() = %v, want one gateway", entities)
+	}
+	exits := entities[0].exits()
+	if len(exits) != 6 {
+		t.Fatalf("exits() returned %v exits, want 6", len(exits))
+	}
+	usernames := map[string]bool{}
+	for _, e := range exits {
+		usernames[e.Username] = true
+		if e.isGateway() || e.session == "" {
+			t.Errorf("exit %v is not a single upstream", e.Username)
+		}
+	}
+	if len(usernames) != 6 {
+		t.Errorf("exits() share usernames: %v", usernames)
+	}
+	if exits[0].Country != "VN" || exits[0].Username != "customer-x-country-vn-session-"+exits[0].session {
+		t.Errorf("exit = %+v", exits[0])
+	}
+	if again := entities[0].exit(0, "VN"); again.Username != exits[0].Username {
+		t.Error("exit() is not stable for a slot")
+	}
+	if leaseKeyName(exits[0]) == leaseKeyName(exits[1]) {
+		t.Error("exits share a lease key")
+	}
+}
+
+func TestNewGatewayFetcher_invalid(t *testing.T) {
+	sources := []config.SourceConfig{
+		{FetcherConfig: config.FetcherConfig{Name: "no port"}, Gateway: "gw.example.com"},
+		{FetcherConfig: config.FetcherConfig{Name: "countries"}, Gateway: "gw.example.com:1", Username: "u", Countries: []string{"VN"}},
+	}
+	for _, source := range sources {
+		if _, err := NewGatewayFetcher(source); err == nil {
+			t.Errorf("NewGatewayFetcher(%v) succeeded", source.Name)
+		}
+	}
+}
+
+func TestRepository_getRandomExits(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository(newTestRedis(t))
+	proxy := &entity{Ip: "10.0.0.1", Port: 8080, Type: Http}
+	gateway := &entity{Ip: "gw.example.com", Port: 22225, Type: Http, Username: "session-{session}", Sessions: 19}
+	err := repo.saveMany(ctx, []*entity{proxy, gateway})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one proxy and 19 exits, the proxy should come up about once in 20 picks
+	picks := map[bool]int{}
+	for i := 0; i < 1000; i++ {
+		exits, err := repo.getRandomExits(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(exits) != 1 {
+			t.Fatalf("getRandomExits(1) returned %v upstreams", len(exits))
+		}
+		picks[exits[0].session == ""]++
+	}
+	if picks[true] > 150 {
+		t.Errorf("the proxy was picked %v times out of 1000, want it weighted like a single exit", picks[true])
+	}
+
+	exits, err := repo.getRandomExits(ctx, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exits) != 20 {
+		t.Errorf("getRandomExits(30) returned %v upstreams, want all 20", len(exits))
+	}
+	seen := map[string]bool{}
+	for _, e := range exits {
+		if e.isGateway() {
+			t.Errorf("getRandomExits() returned the gateway itself")
+		}
+		if seen[leaseKeyName(e)] {
+			t.Errorf("getRandomExits() returned %v twice", leaseKeyName(e))
+		}
+		seen[leaseKeyName(e)] = true
+	}
+}
+
+func TestService_ReportFailure_gateway(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newTestService(t, &config.Config{})
+	gateway := &entity{Ip: "gw.example.com", Port: 22225, Type: Http, Username: "session-{session}", Sessions: 5}
+	err := s.repository.saveMany(ctx, []*entity{gateway})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := s.Subscribe(ctx)
+
+	err = s.ReportFailure(ctx, gateway.Ip, gateway.Port, "")
+	if err != nil {
+		t.Fatalf("ReportFailure() error = %v", err)
+	}
+	if event := waitForEvent(t, events, EventProxyDemoted); event.Reason != ReasonReported {
+		t.Errorf("demoted reason = %v, want %v", event.Reason, ReasonReported)
+	}
+	if _, err := s.Get(ctx, gateway.Ip, gateway.Port); err != nil {
+		t.Errorf("gateway was removed for a failed exit: %v", err)
+	}
+	if queued, _ := s.checkerService.QueueLength(ctx); queued != 1 {
+		t.Errorf("queue length = %v, want the gateway queued for a check", queued)
+	}
+}
@@ -0,0 +1,268 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gocolly/colly/v2"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ParserText = "text"
+	ParserJson = "json"
+	ParserHtml = "html"
+
+	defaultSourcePattern = `(?P<ip>\d{1,3}(?:\.\d{1,3}){3}):(?P<port>\d{1,5})`
+	defaultRowSelector   = "table tbody tr"
+	defaultCellSelector  = "td"
+)
+
+var (
+	ErrInvalidSource = errors.New("invalid source")
+)
+
+// ValidateSources builds every source the way the fetcher job does and reports the ones it would skip
+func ValidateSources(sources []config.SourceConfig) error {
+	var problems []string
+	for i, source := range sources {
+		if _, err := newSourceFetcher(source); err != nil {
+			problems = append(problems, fmt.Sprintf("sources[%v]: %v", i, err))
+		}
+	}
+	if len(problems) > 0 {
+		return &config.ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// newSourceFetcher builds the fetcher of a source declared in config
+func newSourceFetcher(source config.SourceConfig) (Fetcher, error) {
+	switch source.Parser {
+	case ParserFile:
+		return NewFileFetcher(source)
+	case ParserGateway:
+		return NewGatewayFetcher(source)
+	case ParserSubscription:
+		return NewSubscriptionFetcher(source)
+	}
+	return NewGenericFetcher(source)
+}
+
+// GenericFetcher scrapes a source declared in config
+type GenericFetcher struct {
+	source  config.SourceConfig
+	pattern *regexp.Regexp
+	// proxy type used when the source does not tell
+	fallback Type
+}
+
+func NewGenericFetcher(source config.SourceConfig) (*GenericFetcher, error) {
+	if source.Name == "" || source.Url == "" {
+		return nil, fmt.Errorf("%w: name and url are required", ErrInvalidSource)
+	}
+	g := &GenericFetcher{source: source, fallback: Http}
+	if source.Type != "" {
+		t, err := ParseType(source.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%w %v: %v", ErrInvalidSource, source.Name, err)
+		}
+		g.fallback = t
+	}
+	switch source.Parser {
+	case ParserText:
+		pattern := source.Pattern
+		if pattern == "" {
+			pattern = defaultSourcePattern
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w %v: %v", ErrInvalidSource, source.Name, err)
+		}
+		if compiled.SubexpIndex("ip") < 0 || compiled.SubexpIndex("port") < 0 {
+			return nil, fmt.Errorf("%w %v: pattern needs the groups ip and port", ErrInvalidSource, source.Name)
+		}
+		g.pattern = compiled
+	case ParserJson, ParserHtml:
+	default:
+		return nil, fmt.Errorf("%w %v: unknown parser %q", ErrInvalidSource, source.Name, source.Parser)
+	}
+	return g, nil
+}
+
+func (g GenericFetcher) Name() string {
+	return g.source.Name
+}
+
+func (g GenericFetcher) Get(ctx context.Context) ([]*entity, error) {
+	if g.source.Parser == ParserHtml {
+		return g.getHtml(ctx)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.source.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(ctx).Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v from %v", resp.Status, g.source.Url)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if g.source.Parser == ParserJson {
+		return g.parseJson(body)
+	}
+	return g.parseText(body), nil
+}
+
+// newEntity builds an entity from scraped values, it returns nil for rows which are not a proxy
+func (g GenericFetcher) newEntity(ip, port, t, country string) *entity {
+	ip = strings.TrimSpace(ip)
+	if net.ParseIP(ip) == nil {
+		return nil
+	}
+	p, err := strconv.Atoi(strings.TrimSpace(port))
+	if err != nil || p <= 0 || p > 65535 {
+		return nil
+	}
+	e := &entity{
+		Ip:      ip,
+		Port:    p,
+		Type:    g.fallback,
+		Country: strings.TrimSpace(country),
+	}
+	if t != "" {
+		parsed, err := ParseType(t)
+		if err != nil {
+			log.Logger.Debug("unknown proxy type in source", zap.String("name", g.source.Name), zap.String("type", t))
+			return nil
+		}
+		e.Type = parsed
+	}
+	return e
+}
+
+func (g GenericFetcher) parseText(body []byte) []*entity {
+	group := func(match []string, name string) string {
+		if i := g.pattern.SubexpIndex(name); i >= 0 {
+			return match[i]
+		}
+		return ""
+	}
+	var entities []*entity
+	for _, match := range g.pattern.FindAllStringSubmatch(string(body), -1) {
+		e := g.newEntity(group(match, "ip"), group(match, "port"), group(match, "type"), group(match, "country"))
+		if e != nil {
+			entities = append(entities, e)
+		}
+	}
+	return entities
+}
+
+func (g GenericFetcher) parseJson(body []byte) ([]*entity, error) {
+	var parsed interface{}
+	err := json.Unmarshal(body, &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if g.source.Path != "" {
+		for _, key := range strings.Split(g.source.Path, ".") {
+			object, ok := parsed.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("no object at %q in %v", key, g.source.Name)
+			}
+			parsed = object[key]
+		}
+	}
+	items, ok := parsed.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no array at %q in %v", g.source.Path, g.source.Name)
+	}
+	field := func(item map[string]interface{}, name string) string {
+		key, ok := g.source.Fields[name]
+		if !ok {
+			key = name
+		}
+		return jsonString(item[key])
+	}
+	var entities []*entity
+	for _, v := range items {
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		e := g.newEntity(field(item, "ip"), field(item, "port"), field(item, "type"), field(item, "country"))
+		if e != nil {
+			entities = append(entities, e)
+		}
+	}
+	return entities, nil
+}
+
+// jsonString formats a scalar json value, arrays yield their first element
+func jsonString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case []interface{}:
+		if len(value) > 0 {
+			return jsonString(value[0])
+		}
+	}
+	return ""
+}
+
+func (g GenericFetcher) getHtml(ctx context.Context) ([]*entity, error) {
+	rowSelector := g.source.RowSelector
+	if rowSelector == "" {
+		rowSelector = defaultRowSelector
+	}
+	cellSelector := g.source.CellSelector
+	if cellSelector == "" {
+		cellSelector = defaultCellSelector
+	}
+	column := func(cells []string, name string, fallback int) string {
+		i, ok := g.source.Columns[name]
+		if !ok {
+			i = fallback
+		}
+		if i < 0 || i >= len(cells) {
+			return ""
+		}
+		return cells[i]
+	}
+
+	c := newCollector(ctx)
+	var entities []*entity
+	c.OnHTML(rowSelector, func(row *colly.HTMLElement) {
+		var cells []string
+		row.ForEach(cellSelector, func(_ int, cell *colly.HTMLElement) {
+			cells = append(cells, cell.Text)
+		})
+		e := g.newEntity(column(cells, "ip", 0), column(cells, "port", 1), column(cells, "type", -1), column(cells, "country", -1))
+		if e != nil {
+			entities = append(entities, e)
+		}
+	})
+	c.OnRequest(func(r *colly.Request) {
+		log.Logger.Info("visiting url", zap.String("url", r.URL.String()))
+	})
+	err := c.Visit(g.source.Url)
+	return entities, err
+}
@@ -0,0 +1,90 @@
+package pool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"proxy-pool/config"
+	"reflect"
+	"testing"
+)
+
+func TestGenericFetcher_Get(t *testing.T) {
+	bodies := map[string]string{
+		"/list.txt": "1.1.1.1:80\nnot a proxy\n2.2.2.2:1080 socks5\n3.3.3.3:99999\n",
+		"/api":      `{"data":{"proxies":[{"address":"1.1.1.1","port":"80","protocol":["https"]},{"address":"2.2.2.2","port":1080,"protocol":"socks4","cc":"VN"},{"address":"bad","port":1}]}}`,
+		"/table":    `<table><tbody><tr><td>1.1.1.1</td><td>80</td><td>HTTP</td></tr><tr><td>2.2.2.2</td><td>1080</td><td>SOCKS5</td></tr><tr><td>IP</td><td>Port</td><td></td></tr></tbody></table>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(bodies[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		source config.SourceConfig
+		want   []*entity
+	}{
+		{
+			name:   "text",
+			source: config.SourceConfig{Parser: ParserText, Url: server.URL + "/list.txt", Type: "socks5"},
+			want: []*entity{
+				{Ip: "1.1.1.1", Port: 80, Type: Socks5},
+				{Ip: "2.2.2.2", Port: 1080, Type: Socks5},
+			},
+		},
+		{
+			name: "text with type group",
+			source: config.SourceConfig{Parser: ParserText, Url: server.URL + "/list.txt",
+				Pattern: `(?P<ip>[\d.]+):(?P<port>\d+) (?P<type>\w+)`},
+			want: []*entity{{Ip: "2.2.2.2", Port: 1080, Type: Socks5}},
+		},
+		{
+			name: "json",
+			source: config.SourceConfig{Parser: ParserJson, Url: server.URL + "/api", Path: "data.proxies",
+				Fields: map[string]string{"ip": "address", "type": "protocol", "country": "cc"}},
+			want: []*entity{
+				{Ip: "1.1.1.1", Port: 80, Type: Https},
+				{Ip: "2.2.2.2", Port: 1080, Type: Socks4, Country: "VN"},
+			},
+		},
+		{
+			name:   "html",
+			source: config.SourceConfig{Parser: ParserHtml, Url: server.URL + "/table", Columns: map[string]int{"type": 2}},
+			want: []*entity{
+				{Ip: "1.1.1.1", Port: 80, Type: Http},
+				{Ip: "2.2.2.2", Port: 1080, Type: Socks5},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.source.Name = tt.name
+			fetcher, err := NewGenericFetcher(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fetcher.Get(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewGenericFetcher_invalid(t *testing.T) {
+	sources := []config.SourceConfig{
+		{FetcherConfig: config.FetcherConfig{Name: "no url"}, Parser: ParserText},
+		{FetcherConfig: config.FetcherConfig{Name: "parser"}, Url: "http://localhost", Parser: "xml"},
+		{FetcherConfig: config.FetcherConfig{Name: "groups"}, Url: "http://localhost", Parser: ParserText, Pattern: `(\d+)`},
+		{FetcherConfig: config.FetcherConfig{Name: "type"}, Url: "http://localhost", Parser: ParserJson, Type: "ftp"},
+	}
+	for _, source := range sources {
+		if _, err := NewGenericFetcher(source); err == nil {
+			t.Errorf("NewGenericFetcher(%v) succeeded", source.Name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package pool
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"os"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"time"
+)
+
+const (
+	leaderKey            = "lock:fetcher:leader"
+	defaultLeaderLockTtl = time.Second * 30
+)
+
+// the lock is only renewed or released by the replica holding it
+var (
+	renewLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+// LeaderElection picks one replica to run the fetchers through a redis key which expires
+// unless its holder keeps renewing it, so another replica takes over once the leader is gone
+type LeaderElection struct {
+	redis *redis.Client
+	id    string
+	ttl   time.Duration
+}
+
+func NewLeaderElection(cfg *config.Config, redis *redis.Client) *LeaderElection {
+	ttl := cfg.Leader.LockTtl
+	if ttl <= 0 {
+		ttl = defaultLeaderLockTtl
+	}
+	return &LeaderElection{
+		redis: redis,
+		id:    newLeaderId(),
+		ttl:   ttl,
+	}
+}
+
+// newLeaderId names the replica in the lock, containers often share the hostname pattern and pid,
+// the random suffix keeps two of them from renewing each other's lock
+func newLeaderId() string {
+	hostname, _ := os.Hostname()
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%v:%v:%v", hostname, os.Getpid(), time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%v:%v:%v", hostname, os.Getpid(), hex.EncodeToString(b))
+}
+
+// Run calls lead whenever this replica becomes the leader, the context passed to lead is cancelled
+// once the lock is lost. Run returns when ctx is done
+func (l *LeaderElection) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		acquired, err := l.redis.SetNX(ctx, leaderKey, l.id, l.ttl).Result()
+		if err != nil && ctx.Err() == nil {
+			log.Logger.Warn("failed to acquire leader lock", zap.Error(err))
+		}
+		if acquired {
+			log.Logger.Info("elected leader", zap.String("id", l.id))
+			l.hold(ctx, lead)
+			log.Logger.Info("stepped down as leader", zap.String("id", l.id))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// hold runs lead while renewing the lock, then releases it
+func (l *LeaderElection) hold(ctx context.Context, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		// the parent may be done already, the lock is released regardless
+		err := releaseLockScript.Run(context.Background(), l.redis, []string{leaderKey}, l.id).Err()
+		if err != nil {
+			log.Logger.Warn("failed to release leader lock", zap.Error(err))
+		}
+	}()
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			renewed, err := renewLockScript.Run(ctx, l.redis, []string{leaderKey}, l.id, l.ttl.Milliseconds()).Int()
+			if err != nil || renewed == 0 {
+				log.Logger.Warn("lost leader lock", zap.Error(err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package pool
+
+import (
+	"context"
+	"proxy-pool/config"
+	"testing"
+	"time"
+)
+
+func TestNewLeaderElection(t *testing.T) {
+	cfg := &config.Config{}
+	a, b := NewLeaderElection(cfg, nil), NewLeaderElection(cfg, nil)
+	if a.id == b.id {
+		t.Errorf("replicas of one host share the id %v", a.id)
+	}
+	if a.ttl != defaultLeaderLockTtl {
+		t.Errorf("ttl = %v, want %v", a.ttl, defaultLeaderLockTtl)
+	}
+}
+
+func TestLeaderElection_Run(t *testing.T) {
+	client := newTestRedis(t)
+	cfg := &config.Config{Leader: config.LeaderConfig{LockTtl: time.Millisecond * 300}}
+	a, b := NewLeaderElection(cfg, client), NewLeaderElection(cfg, client)
+
+	leading := make(chan string, 2)
+	lead := func(id string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			leading <- id
+			<-ctx.Done()
+		}
+	}
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		defer close(doneA)
+		a.Run(ctxA, lead(a.id))
+	}()
+	select {
+	case id := <-leading:
+		if id != a.id {
+			t.Fatalf("leader = %v, want %v", id, a.id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("first replica was not elected")
+	}
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go b.Run(ctxB, lead(b.id))
+	select {
+	case id := <-leading:
+		t.Fatalf("%v was elected while %v holds the lock", id, a.id)
+	case <-time.After(time.Millisecond * 500):
+	}
+
+	cancelA()
+	<-doneA
+	select {
+	case id := <-leading:
+		if id != b.id {
+			t.Errorf("leader = %v, want %v", id, b.id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second replica did not take over")
+	}
+}
+
+func TestLeaderElection_Run_lostLock(t *testing.T) {
+	client := newTestRedis(t)
+	cfg := &config.Config{Leader: config.LeaderConfig{LockTtl: time.Millisecond * 300}}
+	l := NewLeaderElection(cfg, client)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	elected, stepped := make(chan struct{}), make(chan struct{})
+	go l.Run(ctx, func(ctx context.Context) {
+		close(elected)
+		<-ctx.Done()
+		close(stepped)
+	})
+	select {
+	case <-elected:
+	case <-time.After(time.Second):
+		t.Fatal("replica was not elected")
+	}
+	// another replica took the lock over after a pause longer than the ttl, it never expires here
+	if err := client.Set(context.Background(), leaderKey, "other", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stepped:
+	case <-time.After(time.Second):
+		t.Fatal("leader kept leading without the lock")
+	}
+	if got := client.Get(context.Background(), leaderKey).Val(); got != "other" {
+		t.Errorf("lock holder = %v, want the other replica to keep it", got)
+	}
+}
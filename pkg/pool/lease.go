@@ -0,0 +1,242 @@
+package pool
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	mathrand "math/rand"
+	"proxy-pool/pkg/log"
+	"time"
+)
+
+const (
+	// lease:<id> points to the key of the leased proxy
+	leaseKeyPrefix = "lease:"
+	// leased:<proxy key> holds the id of the lease owning the proxy
+	leasedKeyPrefix = "leased:"
+	defaultLeaseTtl = time.Minute * 5
+	// source of proxies added through Import
+	importSource = "import"
+)
+
+var (
+	ErrNoProxyAvailable = errors.New("no proxy available")
+	ErrLeaseNotFound    = errors.New("lease not found")
+	ErrInvalidProxy     = errors.New("invalid proxy")
+)
+
+type Lease struct {
+	Id        string    `json:"id"`
+	Proxy     *Proxy    `json:"proxy"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	// takes the proxy for the lease and records the lease in one step, so a proxy is never held without a lease
+	acquireLeaseScript = redis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[3]) then
+	redis.call("set", KEYS[2], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0`)
+	// frees the proxy only while the released lease still owns it, it may have expired and been leased again
+	releaseLeaseScript = redis.NewScript(`
+redis.call("del", KEYS[1])
+if redis.call("get", KEYS[2]) == ARGV[1] then
+	redis.call("del", KEYS[2])
+end
+return 1`)
+)
+
+func newLeaseId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// withoutLeased drops the upstreams a lease holds, the holder has them to itself
+func (r repository) withoutLeased(ctx context.Context, entities []*entity) ([]*entity, error) {
+	if len(entities) == 0 {
+		return entities, nil
+	}
+	pipeline := r.redis.Pipeline()
+	leased := make([]*redis.IntCmd, 0, len(entities))
+	for _, e := range entities {
+		leased = append(leased, pipeline.Exists(ctx, leasedKeyPrefix+leaseKeyName(e)))
+	}
+	_, err := pipeline.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	free := make([]*entity, 0, len(entities))
+	for i, e := range entities {
+		if leased[i].Val() == 0 {
+			free = append(free, e)
+		}
+	}
+	return free, nil
+}
+
+// GetRandom returns up to count random proxies matching the filter which no lease holds
+func (s Service) GetRandom(ctx context.Context, count int, filter Filter) ([]*entity, error) {
+	if filter.Type == "" && filter.Country == "" {
+		return s.GetByRandom(ctx, int64(count))
+	}
+	filter.Limit = 0
+	entities, err := s.Exits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	entities, err = s.repository.withoutLeased(ctx, entities)
+	if err != nil {
+		return nil, err
+	}
+	mathrand.Shuffle(len(entities), func(i, j int) {
+		entities[i], entities[j] = entities[j], entities[i]
+	})
+	if len(entities) > count {
+		entities = entities[:count]
+	}
+	return entities, nil
+}
+
+// Lease hands out a proxy matching the filter which no other lease holds
+func (s Service) Lease(ctx context.Context, filter Filter, ttl time.Duration) (*Lease, error) {
+	if ttl <= 0 {
+		ttl = defaultLeaseTtl
+	}
+	filter.Limit = 0
+	entities, err := s.Exits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	mathrand.Shuffle(len(entities), func(i, j int) {
+		entities[i], entities[j] = entities[j], entities[i]
+	})
+	id, err := newLeaseId()
+	if err != nil {
+		return nil, err
+	}
+	redisClient := s.repository.redis
+	for _, e := range entities {
+		key := leaseKeyName(e)
+		acquired, err := acquireLeaseScript.Run(ctx, redisClient,
+			[]string{leasedKeyPrefix + key, leaseKeyPrefix + id}, id, key, ttl.Milliseconds()).Int()
+		if err != nil {
+			return nil, err
+		}
+		if acquired == 0 {
+			continue
+		}
+		s.events.Publish(ctx, newProxyEvent(EventLeaseTaken, e))
+		return &Lease{
+			Id:        id,
+			Proxy:     e.ToProxy(),
+			ExpiresAt: time.Now().Add(ttl),
+		}, nil
+	}
+	return nil, ErrNoProxyAvailable
+}
+
+func (s Service) Release(ctx context.Context, id string) error {
+	redisClient := s.repository.redis
+	key, err := redisClient.Get(ctx, leaseKeyPrefix+id).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrLeaseNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return releaseLeaseScript.Run(ctx, redisClient, []string{leaseKeyPrefix + id, leasedKeyPrefix + key}, id).Err()
+}
+
+// ReportFailure removes a proxy a client failed to use and queues it for another check,
+// so it comes back if the failure was specific to that client's target. A gateway is only rechecked
+func (s Service) ReportFailure(ctx context.Context, ip string, port int, reason string) error {
+	e, err := s.Get(ctx, ip, port)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		reason = ReasonReported
+	}
+	if e.isGateway() {
+		// the address is shared by all exits of the gateway, the checker decides on it
+		log.Logger.Debug("keeping gateway of failed exit", zap.String("proxy", buildKeyName(e)), zap.String("reason", reason))
+		s.demoted(ctx, e, reason)
+		return s.Recheck(ctx, e)
+	}
+	err = s.Delete(ctx, e, reason)
+	if err != nil {
+		return err
+	}
+	return s.Recheck(ctx, e)
+}
+
+// Import adds proxies through the checker queue, or straight into the pool with skipCheck
+func (s Service) Import(ctx context.Context, proxies []*Proxy, skipCheck bool) (int, error) {
+	entities := make([]*entity, 0, len(proxies))
+	for _, p := range proxies {
+		e, err := fromProxy(p)
+		if err != nil {
+			return 0, err
+		}
+		if e.Source == "" {
+			e.Source = importSource
+		}
+		e.LastSeenInSource = time.Now().Unix()
+		entities = append(entities, e)
+	}
+	if skipCheck {
+		err := s.SaveMany(ctx, entities)
+		if err != nil {
+			return 0, err
+		}
+		for _, e := range entities {
+			s.events.Publish(ctx, newProxyEvent(EventProxyAdded, e))
+		}
+		return len(entities), nil
+	}
+	for i, e := range entities {
+		err := s.checkerService.Requeue(ctx, e)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(entities), nil
+}
+
+func fromProxy(p *Proxy) (*entity, error) {
+	if p.Ip == "" || p.Port <= 0 || p.Port > 65535 {
+		return nil, fmt.Errorf("%w: %v:%v", ErrInvalidProxy, p.Ip, p.Port)
+	}
+	t, err := ParseType(string(p.Type))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProxy, err)
+	}
+	return &entity{
+		Ip:       p.Ip,
+		Port:     p.Port,
+		Type:     t,
+		Country:  p.Country,
+		Latency:  p.Latency,
+		Username: p.Username,
+		Password: p.Password,
+		Source:   p.Source,
+
+		Sources:          p.Sources,
+		FirstSeen:        p.FirstSeen,
+		LastSeenInSource: p.LastSeenInSource,
+		LastChecked:      p.LastChecked,
+		LastUsed:         p.LastUsed,
+		Sessions:         p.Sessions,
+		Countries:        p.Countries,
+	}, nil
+}
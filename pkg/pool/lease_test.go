@@ -0,0 +1,174 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"proxy-pool/config"
+	"testing"
+	"time"
+)
+
+// newTestPool is a pool service holding entities
+func newTestPool(t *testing.T, entities ...*entity) *Service {
+	t.Helper()
+	s := newTestService(t, &config.Config{})
+	err := s.SaveMany(context.Background(), entities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestService_Lease(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPool(t,
+		&entity{Ip: "10.0.0.1", Port: 80, Type: Http},
+		&entity{Ip: "10.0.0.2", Port: 80, Type: Http},
+	)
+
+	first, err := s.Lease(ctx, Filter{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Lease(ctx, Filter{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Proxy.Ip == second.Proxy.Ip {
+		t.Errorf("both leases hold %v", first.Proxy.Ip)
+	}
+	_, err = s.Lease(ctx, Filter{}, time.Minute)
+	if !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("Lease() of a fully leased pool error = %v, want %v", err, ErrNoProxyAvailable)
+	}
+
+	err = s.Release(ctx, first.Id)
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	again, err := s.Lease(ctx, Filter{}, time.Minute)
+	if err != nil {
+		t.Fatalf("Lease() after Release() error = %v", err)
+	}
+	if again.Proxy.Ip != first.Proxy.Ip {
+		t.Errorf("Lease() = %v, want the released %v", again.Proxy.Ip, first.Proxy.Ip)
+	}
+	err = s.Release(ctx, first.Id)
+	if !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Release() twice error = %v, want %v", err, ErrLeaseNotFound)
+	}
+}
+
+func TestService_GetRandom_skipsLeased(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPool(t,
+		&entity{Ip: "10.0.0.1", Port: 80, Type: Http, Country: "VN"},
+		&entity{Ip: "10.0.0.2", Port: 80, Type: Http, Country: "VN"},
+	)
+	lease, err := s.Lease(ctx, Filter{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filter := range []Filter{{}, {Country: "VN"}} {
+		for i := 0; i < 10; i++ {
+			entities, err := s.GetRandom(ctx, 2, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entities) != 1 || entities[0].Ip == lease.Proxy.Ip {
+				t.Fatalf("GetRandom(%+v) = %v, want only the proxy which is not leased", filter, entities)
+			}
+		}
+	}
+}
+
+func TestService_ReportFailure(t *testing.T) {
+	ctx := context.Background()
+	proxy := &entity{Ip: "10.0.0.1", Port: 80, Type: Http}
+	s := newTestPool(t, proxy)
+
+	err := s.ReportFailure(ctx, proxy.Ip, proxy.Port, "")
+	if err != nil {
+		t.Fatalf("ReportFailure() error = %v", err)
+	}
+	if _, err := s.Get(ctx, proxy.Ip, proxy.Port); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a reported proxy error = %v, want %v", err, ErrNotFound)
+	}
+	if queued, _ := s.checkerService.QueueLength(ctx); queued != 1 {
+		t.Errorf("queue length = %v, want the proxy queued for a check", queued)
+	}
+	err = s.ReportFailure(ctx, proxy.Ip, proxy.Port, "")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReportFailure() of an unknown proxy error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestService_Import(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPool(t)
+
+	imported, err := s.Import(ctx, []*Proxy{{Ip: "10.0.0.1", Port: 80, Type: Http}}, true)
+	if err != nil || imported != 1 {
+		t.Fatalf("Import() = %v %v, want 1", imported, err)
+	}
+	e, err := s.Get(ctx, "10.0.0.1", 80)
+	if err != nil {
+		t.Fatalf("imported proxy is not in the pool: %v", err)
+	}
+	if e.Source != importSource || e.LastSeenInSource == 0 {
+		t.Errorf("imported proxy = %+v, want source %v and last seen set", e, importSource)
+	}
+
+	imported, err = s.Import(ctx, []*Proxy{{Ip: "10.0.0.2", Port: 80, Type: Socks5}}, false)
+	if err != nil || imported != 1 {
+		t.Fatalf("Import() = %v %v, want 1", imported, err)
+	}
+	if _, err := s.Get(ctx, "10.0.0.2", 80); !errors.Is(err, ErrNotFound) {
+		t.Errorf("proxy imported with a check joined the pool before it: %v", err)
+	}
+	if queued, _ := s.checkerService.QueueLength(ctx); queued != 1 {
+		t.Errorf("queue length = %v, want the proxy queued for a check", queued)
+	}
+
+	_, err = s.Import(ctx, []*Proxy{{Ip: "10.0.0.3", Port: 0, Type: Http}}, true)
+	if !errors.Is(err, ErrInvalidProxy) {
+		t.Errorf("Import() of an invalid proxy error = %v, want %v", err, ErrInvalidProxy)
+	}
+}
+
+func TestService_Release_expired(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPool(t, &entity{Ip: "10.0.0.1", Port: 80, Type: Http})
+	stale, err := s.Lease(ctx, Filter{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the proxy expired from the stale lease and was leased again before the stale lease was released
+	leased := leasedKeyPrefix + buildKeyName(&entity{Ip: "10.0.0.1", Port: 80})
+	err = s.repository.redis.Del(ctx, leased).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := s.Lease(ctx, Filter{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{leased, leaseKeyPrefix + current.Id} {
+		if ttl := s.repository.redis.PTTL(ctx, key).Val(); ttl <= 0 || ttl > time.Minute {
+			t.Errorf("ttl of %v = %v, want the lease ttl", key, ttl)
+		}
+	}
+
+	err = s.Release(ctx, stale.Id)
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if owner := s.repository.redis.Get(ctx, leased).Val(); owner != current.Id {
+		t.Errorf("proxy held by %q, want the current lease %v", owner, current.Id)
+	}
+	_, err = s.Lease(ctx, Filter{}, time.Minute)
+	if !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("Lease() of the leased proxy error = %v, want %v", err, ErrNoProxyAvailable)
+	}
+}
@@ -0,0 +1,112 @@
+package pool
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"proxy-pool/pkg/metrics"
+	"time"
+)
+
+// the pool collector reads redis on every scrape, a slow redis fails the scrape instead of blocking it
+const collectTimeout = time.Second * 5
+
+var (
+	checksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "checks_total",
+		Help:      "Proxy checks by result and error class, the class is empty for passed checks.",
+	}, []string{"result", "class"})
+	checkDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "check_duration_seconds",
+		Help:      "Time a proxy took to answer the check request.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"result"})
+	fetcherRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "fetcher_runs_total",
+		Help:      "Fetcher runs by source and result.",
+	}, []string{"source", "result"})
+	fetcherRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "fetcher_run_duration_seconds",
+		Help:      "Time a fetcher run took.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"source"})
+	fetcherProxiesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "fetcher_proxies_total",
+		Help:      "Proxies returned by the fetcher runs, before duplicates are dropped.",
+	}, []string{"source"})
+)
+
+func observeCheck(result CheckResult) {
+	label := "passed"
+	if result.Err != nil {
+		label = "failed"
+	}
+	checksTotal.WithLabelValues(label, string(result.Class)).Inc()
+	checkDuration.WithLabelValues(label).Observe(result.Latency.Seconds())
+}
+
+func observeFetcherRun(result FetchResult) {
+	label := "succeeded"
+	if result.Err != nil {
+		label = "failed"
+	}
+	fetcherRunsTotal.WithLabelValues(result.Name, label).Inc()
+	fetcherRunDuration.WithLabelValues(result.Name).Observe(result.Duration.Seconds())
+	fetcherProxiesTotal.WithLabelValues(result.Name).Add(float64(result.Count))
+}
+
+var (
+	poolSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "", "size"),
+		"Proxies in the pool by type and country.",
+		[]string{"type", "country"}, nil,
+	)
+	queueDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "checker", "queue_depth"),
+		"Proxies waiting in the checker queue.",
+		nil, nil,
+	)
+)
+
+// PoolCollector reports the size of the pool and of the checker queue as they are in redis.
+// Every replica sees the same values, so one role registering it is enough
+type PoolCollector struct {
+	poolService *Service
+}
+
+func NewPoolCollector(poolService *Service) *PoolCollector {
+	return &PoolCollector{poolService: poolService}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolSizeDesc
+	ch <- queueDepthDesc
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	entities, err := c.poolService.repository.getAll(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(poolSizeDesc, err)
+	} else {
+		sizes := map[[2]string]int{}
+		for _, e := range entities {
+			sizes[[2]string{string(e.Type), e.Country}]++
+		}
+		for labels, size := range sizes {
+			ch <- prometheus.MustNewConstMetric(poolSizeDesc, prometheus.GaugeValue, float64(size), labels[0], labels[1])
+		}
+	}
+	depth, err := c.poolService.checkerService.QueueLength(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(queueDepthDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth))
+}
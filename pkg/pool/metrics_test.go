@@ -0,0 +1,40 @@
+package pool
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+	"time"
+)
+
+func TestObserveCheck(t *testing.T) {
+	passed := checksTotal.WithLabelValues("passed", "")
+	refused := checksTotal.WithLabelValues("failed", string(ErrorClassRefused))
+	passedBefore, refusedBefore := testutil.ToFloat64(passed), testutil.ToFloat64(refused)
+
+	observeCheck(CheckResult{Latency: time.Millisecond * 200})
+	observeCheck(CheckResult{Latency: time.Millisecond, Class: ErrorClassRefused, Err: errors.New("refused")})
+	observeCheck(CheckResult{Latency: time.Millisecond, Class: ErrorClassRefused, Err: errors.New("refused")})
+
+	if got := testutil.ToFloat64(passed) - passedBefore; got != 1 {
+		t.Errorf("passed checks = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(refused) - refusedBefore; got != 2 {
+		t.Errorf("refused checks = %v, want 2", got)
+	}
+}
+
+func TestObserveFetcherRun(t *testing.T) {
+	observeFetcherRun(FetchResult{Name: "metrics-test", Count: 7, Duration: time.Second})
+	observeFetcherRun(FetchResult{Name: "metrics-test", Err: errors.New("timeout")})
+
+	if got := testutil.ToFloat64(fetcherRunsTotal.WithLabelValues("metrics-test", "succeeded")); got != 1 {
+		t.Errorf("succeeded runs = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(fetcherRunsTotal.WithLabelValues("metrics-test", "failed")); got != 1 {
+		t.Errorf("failed runs = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(fetcherProxiesTotal.WithLabelValues("metrics-test")); got != 7 {
+		t.Errorf("fetched proxies = %v, want 7", got)
+	}
+}
@@ -0,0 +1,117 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"proxy-pool/config"
+	"sort"
+	"strings"
+)
+
+const pacDomainKey = "pac:domain:set"
+
+var (
+	ErrInvalidDomain = errors.New("invalid domain pattern")
+)
+
+// PacService manages the domain patterns which browsers send through the pool
+type PacService struct {
+	cfg   *config.Config
+	redis *redis.Client
+}
+
+func NewPacService(cfg *config.Config, redis *redis.Client) *PacService {
+	return &PacService{cfg: cfg, redis: redis}
+}
+
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSpace(domain)
+	domain = strings.ToLower(domain)
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" || strings.ContainsAny(domain, " \t\"'\\/:") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+	}
+	return domain, nil
+}
+
+// Domains returns the patterns from config merged with the ones added through the api
+func (p PacService) Domains(ctx context.Context) ([]string, error) {
+	stored, err := p.redis.SMembers(ctx, pacDomainKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var domains []string
+	for _, d := range append(p.cfg.Pac.Domains, stored...) {
+		d, err := normalizeDomain(d)
+		if err != nil || seen[d] {
+			continue
+		}
+		seen[d] = true
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
+
+func (p PacService) AddDomain(ctx context.Context, domain string) error {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+	return p.redis.SAdd(ctx, pacDomainKey, domain).Err()
+}
+
+// RemoveDomain removes a pattern added through the api, patterns from config stay
+func (p PacService) RemoveDomain(ctx context.Context, domain string) error {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+	return p.redis.SRem(ctx, pacDomainKey, domain).Err()
+}
+
+// Generate builds a pac file routing the configured domains through proxyAddr
+func (p PacService) Generate(ctx context.Context, proxyAddr string) (string, error) {
+	if p.cfg.Pac.ProxyAddr != "" {
+		proxyAddr = p.cfg.Pac.ProxyAddr
+	}
+	domains, err := p.Domains(ctx)
+	if err != nil {
+		return "", err
+	}
+	return buildPac(domains, proxyAddr)
+}
+
+// buildPac only routes https and wss urls, the front proxy tunnels CONNECT requests only
+func buildPac(domains []string, proxyAddr string) (string, error) {
+	if domains == nil {
+		domains = []string{}
+	}
+	list, err := json.Marshal(domains)
+	if err != nil {
+		return "", err
+	}
+	directive, err := json.Marshal("PROXY " + proxyAddr)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`function FindProxyForURL(url, host) {
+	var domains = %s;
+	if (url.substring(0, 6) !== "https:" && url.substring(0, 4) !== "wss:") {
+		return "DIRECT";
+	}
+	host = host.toLowerCase();
+	for (var i = 0; i < domains.length; i++) {
+		var d = domains[i];
+		if (d.indexOf("*") >= 0 ? shExpMatch(host, d) : (host === d || dnsDomainIs(host, "." + d))) {
+			return %s;
+		}
+	}
+	return "DIRECT";
+}
+`, list, directive), nil
+}
@@ -0,0 +1,31 @@
+package pool
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPac(t *testing.T) {
+	pac, err := buildPac([]string{"example.com", "*.tiktok.com"}, "proxy.local:3001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`["example.com","*.tiktok.com"]`, `return "PROXY proxy.local:3001";`, `return "DIRECT";`} {
+		if !strings.Contains(pac, s) {
+			t.Errorf("expected %q in pac:\n%v", s, pac)
+		}
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	d, err := normalizeDomain(" .Example.COM ")
+	if err != nil || d != "example.com" {
+		t.Errorf("unexpected result %v %v", d, err)
+	}
+	for _, invalid := range []string{"", "a b.com", `x";alert(1);"`, "http://x.com"} {
+		_, err := normalizeDomain(invalid)
+		if err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
@@ -2,4 +2,4 @@ package pool
 
 import "github.com/google/wire"
 
-var Set = wire.NewSet(NewFetcherJob, NewCheckerService, NewRepository, NewPoolService)
+var Set = wire.NewSet(NewFetcherJob, NewCheckerService, NewRepository, NewPoolService, NewPacService, NewEventBus, NewAlertService, NewStatsService, NewExpiryService, NewLeaderElection)
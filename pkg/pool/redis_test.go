@@ -0,0 +1,33 @@
+package pool
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"proxy-pool/config"
+	"testing"
+)
+
+// newTestRedis starts an in-memory redis which lives as long as the test
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// newTestService wires the services of the pool to an in-memory redis, without fetchers
+func newTestService(t *testing.T, cfg *config.Config) *Service {
+	t.Helper()
+	client := newTestRedis(t)
+	repo := NewRepository(client)
+	events := NewEventBus(client)
+	stats := NewStatsService(client)
+	checker := NewCheckerService(cfg, client, events, stats)
+	expiry := NewExpiryService(cfg, repo, checker, events)
+	return NewPoolService(repo, nil, checker, events, nil, stats, expiry, nil)
+}
@@ -31,9 +31,10 @@ const (
 
 var (
 	ErrEmptyPool = errors.New("empty pool")
+	ErrNotFound  = errors.New("proxy not found")
 )
 
-func parseType(t string) (Type, error) {
+func ParseType(t string) (Type, error) {
 	t = strings.TrimSpace(t)
 	t = strings.ToLower(t)
 	switch t {
@@ -52,6 +53,21 @@ func parseType(t string) (Type, error) {
 
 const indexKey = "index:proxy:set"
 
+// gatewayIndexKey lists the gateways of the index, selection weights them by their exits
+const gatewayIndexKey = "index:gateway:set"
+
+// hsetIfIndexedScript updates a proxy hash only while the index lists it, a write racing
+// a delete would otherwise leave a hash behind which no index entry points to
+var hsetIfIndexedScript = redis.NewScript(`
+if redis.call("sismember", KEYS[1], KEYS[2]) == 1 then
+	return redis.call("hset", KEYS[2], unpack(ARGV))
+end
+return 0`)
+
+func hsetIfIndexed(ctx context.Context, c redis.Cmdable, e *entity, values ...interface{}) *redis.Cmd {
+	return hsetIfIndexedScript.Eval(ctx, c, []string{indexKey, buildKeyName(e)}, values...)
+}
+
 type entity struct {
 	Ip       string `mapstructure:"ip"`
 	Port     int    `mapstructure:"port"`
@@ -60,16 +76,56 @@ type entity struct {
 	Latency  int    `mapstructure:"latency"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	// name of the fetcher which found the proxy
+	Source string `mapstructure:"source"`
+	// every fetcher which has found the proxy
+	Sources []string `mapstructure:"sources"`
+	// unix times
+	FirstSeen        int64 `mapstructure:"first_seen"`
+	LastSeenInSource int64 `mapstructure:"last_seen_in_source"`
+	LastChecked      int64 `mapstructure:"last_checked"`
+	LastUsed         int64 `mapstructure:"last_used"`
+	// set on gateways, Username is then a template and the entity stands for many exits
+	Sessions  int      `mapstructure:"sessions"`
+	Countries []string `mapstructure:"countries"`
+	// set on queued proxies which were checked before, only the first check after a fetch counts for the source
+	Recheck bool `mapstructure:"-"`
+	// set on the exits of a gateway
+	session string
+}
+
+// address is the host and port to dial, IPv6 hosts are put in brackets
+func (e *entity) address() string {
+	return net.JoinHostPort(e.Ip, strconv.Itoa(e.Port))
 }
 
 func (e *entity) GetProxyUri() string {
 	if e.Type == Socks5 || e.Type == Socks4 {
-		return fmt.Sprintf("%v://%v:%v?timeout=5s", e.Type, e.Ip, e.Port)
+		return fmt.Sprintf("%v://%v?timeout=5s", e.Type, e.address())
 	}
 	if e.Username != "" && e.Password != "" {
-		return fmt.Sprintf("%v://%v:%v@%v:%v", "http", e.Username, e.Password, e.Ip, e.Port)
+		return fmt.Sprintf("%v://%v:%v@%v", "http", e.Username, e.Password, e.address())
 	} else {
-		return fmt.Sprintf("%v://%v:%v", "http", e.Ip, e.Port)
+		return fmt.Sprintf("%v://%v", "http", e.address())
+	}
+}
+
+// transport sends requests through the proxy, connections are not kept for reuse
+func (e *entity) transport() *http.Transport {
+	if e.Type == Socks4 || e.Type == Socks5 {
+		dial := socks.Dial(e.GetProxyUri())
+		return &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dial(network, addr)
+			},
+			DisableKeepAlives: true,
+		}
+	}
+	return &http.Transport{
+		Proxy: func(*http.Request) (*url.URL, error) {
+			return url.Parse(e.GetProxyUri())
+		},
+		DisableKeepAlives: true,
 	}
 }
 
@@ -91,7 +147,7 @@ func (e *entity) GetDialFunc() func(string, string) (net.Conn, error) {
 				},
 			}
 			// open connection to upper proxy
-			c, err := net.DialTimeout(network, fmt.Sprintf("%v:%v", e.Ip, e.Port), time.Second*5)
+			c, err := net.DialTimeout(network, e.address(), time.Second*5)
 			if err != nil {
 				return nil, err
 			}
@@ -131,7 +187,7 @@ func (e *entity) GetDialFunc() func(string, string) (net.Conn, error) {
 				},
 			}
 
-			c, err := net.Dial(network, fmt.Sprintf("%v:%v", e.Ip, e.Port))
+			c, err := net.Dial(network, e.address())
 			if err != nil {
 				return nil, err
 			}
@@ -177,68 +233,298 @@ func NewRepository(client *redis.Client) *repository {
 }
 
 func (r repository) saveMany(ctx context.Context, entities []*entity) error {
+	err := r.mergeProvenance(ctx, entities)
+	if err != nil {
+		return err
+	}
 	pipeline := r.redis.Pipeline()
 	for _, e := range entities {
 		m := map[string]interface{}{
-			"ip":       e.Ip,
-			"port":     strconv.Itoa(e.Port),
-			"type":     string(e.Type),
-			"country":  e.Country,
-			"latency":  strconv.Itoa(e.Latency),
-			"username": e.Username,
-			"password": e.Password,
+			"ip":                  e.Ip,
+			"port":                strconv.Itoa(e.Port),
+			"type":                string(e.Type),
+			"country":             e.Country,
+			"latency":             strconv.Itoa(e.Latency),
+			"username":            e.Username,
+			"password":            e.Password,
+			"source":              e.Source,
+			"sources":             strings.Join(e.Sources, ","),
+			"first_seen":          e.FirstSeen,
+			"last_seen_in_source": e.LastSeenInSource,
+			"last_checked":        e.LastChecked,
+			"last_used":           e.LastUsed,
+			"sessions":            e.Sessions,
+			"countries":           strings.Join(e.Countries, ","),
 		}
 		// save to hash
 		pipeline.HMSet(ctx, buildKeyName(e), m)
 		// add index
 		pipeline.SAdd(ctx, indexKey, buildKeyName(e))
+		if e.isGateway() {
+			pipeline.SAdd(ctx, gatewayIndexKey, buildKeyName(e))
+		}
+	}
+	_, err = pipeline.Exec(ctx)
+	return err
+}
+
+// mergeProvenance keeps the provenance of proxies already in the pool when they are saved again
+func (r repository) mergeProvenance(ctx context.Context, entities []*entity) error {
+	pipeline := r.redis.Pipeline()
+	commands := make([]*redis.SliceCmd, 0, len(entities))
+	for _, e := range entities {
+		commands = append(commands, pipeline.HMGet(ctx, buildKeyName(e), "sources", "first_seen", "last_seen_in_source", "last_checked", "last_used"))
+	}
+	if len(commands) > 0 {
+		_, err := pipeline.Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now().Unix()
+	for i, e := range entities {
+		stored := make([]string, 5)
+		for j, v := range commands[i].Val() {
+			stored[j], _ = v.(string)
+		}
+		e.Sources = mergeSources(splitSources(stored[0]), append(e.Sources, e.Source)...)
+		if firstSeen := parseInt64(stored[1]); firstSeen > 0 && (e.FirstSeen == 0 || firstSeen < e.FirstSeen) {
+			e.FirstSeen = firstSeen
+		}
+		if e.FirstSeen == 0 {
+			e.FirstSeen = now
+		}
+		e.LastSeenInSource = maxInt64(e.LastSeenInSource, parseInt64(stored[2]))
+		e.LastChecked = maxInt64(e.LastChecked, parseInt64(stored[3]))
+		e.LastUsed = maxInt64(e.LastUsed, parseInt64(stored[4]))
+	}
+	return nil
+}
+
+// markSeen records that a source still lists proxies which are in the pool
+func (r repository) markSeen(ctx context.Context, entities []*entity, source string) error {
+	err := r.mergeProvenance(ctx, entities)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	pipeline := r.redis.Pipeline()
+	for _, e := range entities {
+		e.Sources = mergeSources(e.Sources, source)
+		hsetIfIndexed(ctx, pipeline, e, "sources", strings.Join(e.Sources, ","), "last_seen_in_source", now)
+	}
+	_, err = pipeline.Exec(ctx)
+	return err
+}
+
+// setSources replaces the sources of a proxy unless it has left the pool in the meantime
+func (r repository) setSources(ctx context.Context, e *entity, sources []string) error {
+	return hsetIfIndexed(ctx, r.redis, e, "sources", strings.Join(sources, ",")).Err()
+}
+
+// markUsed sets last_used unless the proxy has left the pool in the meantime
+func (r repository) markUsed(ctx context.Context, e *entity) error {
+	return hsetIfIndexed(ctx, r.redis, e, "last_used", time.Now().Unix()).Err()
+}
+
+// stampMissingTimes sets last_checked and last_seen_in_source where they have never been recorded
+func (r repository) stampMissingTimes(ctx context.Context, entities []*entity, now int64) error {
+	pipeline := r.redis.Pipeline()
+	for _, e := range entities {
+		var values []interface{}
+		if e.LastChecked == 0 {
+			values = append(values, "last_checked", now)
+		}
+		if e.LastSeenInSource == 0 {
+			values = append(values, "last_seen_in_source", now)
+		}
+		if len(values) > 0 {
+			hsetIfIndexed(ctx, pipeline, e, values...)
+		}
 	}
 	_, err := pipeline.Exec(ctx)
 	return err
 }
 
-func (r repository) delete(ctx context.Context, entity *entity) error {
+// removeDangling drops index entries whose hash is gone
+func (r repository) removeDangling(ctx context.Context) error {
+	for _, index := range []string{indexKey, gatewayIndexKey} {
+		err := r.removeDanglingFrom(ctx, index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r repository) removeDanglingFrom(ctx context.Context, index string) error {
+	keys, err := r.redis.SMembers(ctx, index).Result()
+	if err != nil || len(keys) == 0 {
+		return err
+	}
 	pipeline := r.redis.Pipeline()
+	commands := make([]*redis.IntCmd, 0, len(keys))
+	for _, k := range keys {
+		commands = append(commands, pipeline.Exists(ctx, k))
+	}
+	_, err = pipeline.Exec(ctx)
+	if err != nil {
+		return err
+	}
+	var dangling []interface{}
+	for i, cmd := range commands {
+		if cmd.Val() == 0 {
+			dangling = append(dangling, keys[i])
+		}
+	}
+	if len(dangling) == 0 {
+		return nil
+	}
+	return r.redis.SRem(ctx, index, dangling...).Err()
+}
+
+func (e *entity) hasSource(source string) bool {
+	if e.Source == source {
+		return true
+	}
+	for _, s := range e.Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+func splitSources(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// mergeSources adds the names missing from sources, keeping the order
+func mergeSources(sources []string, names ...string) []string {
+	result := make([]string, 0, len(sources)+len(names))
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	for _, name := range sources {
+		add(name)
+	}
+	for _, name := range names {
+		add(name)
+	}
+	return result
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (r repository) delete(ctx context.Context, entity *entity) error {
+	pipeline := r.redis.TxPipeline()
 	// remove from index
 	pipeline.SRem(ctx, indexKey, buildKeyName(entity))
+	pipeline.SRem(ctx, gatewayIndexKey, buildKeyName(entity))
 	// remove hash
 	pipeline.Del(ctx, buildKeyName(entity))
 	_, err := pipeline.Exec(ctx)
 	return err
 }
 
-func (r repository) getByRandom(ctx context.Context, count int64) ([]*entity, error) {
-	// get random key name from index
-	key, err := r.redis.SRandMemberN(ctx, indexKey, count).Result()
+func (r repository) get(ctx context.Context, ip string, port int) (*entity, error) {
+	result, err := r.redis.HGetAll(ctx, buildKeyName(&entity{Ip: ip, Port: port})).Result()
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return nil, ErrEmptyPool
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, ErrNotFound
+	}
+	return decodeEntity(result)
+}
+
+func (r repository) count(ctx context.Context) (int64, error) {
+	return r.redis.SCard(ctx, indexKey).Result()
+}
+
+// exists tells for each entity whether it is in the pool
+func (r repository) exists(ctx context.Context, entities []*entity) ([]bool, error) {
+	pipeline := r.redis.Pipeline()
+	commands := make([]*redis.BoolCmd, 0, len(entities))
+	for _, e := range entities {
+		commands = append(commands, pipeline.SIsMember(ctx, indexKey, buildKeyName(e)))
+	}
+	if len(commands) > 0 {
+		_, err := pipeline.Exec(ctx)
+		if err != nil {
+			return nil, err
 		}
+	}
+	result := make([]bool, 0, len(commands))
+	for _, cmd := range commands {
+		result = append(result, cmd.Val())
+	}
+	return result, nil
+}
+
+func (r repository) getAll(ctx context.Context) ([]*entity, error) {
+	keys, err := r.redis.SMembers(ctx, indexKey).Result()
+	if err != nil {
 		return nil, err
 	}
+	return r.getMany(ctx, keys)
+}
 
-	// load data of that key
-	var entities []*entity
-	for _, k := range key {
-		result, err := r.redis.HGetAll(ctx, k).Result()
+// getMany loads the proxies of keys, the ones removed meanwhile are left out
+func (r repository) getMany(ctx context.Context, keys []string) ([]*entity, error) {
+	pipeline := r.redis.Pipeline()
+	commands := make([]*redis.StringStringMapCmd, 0, len(keys))
+	for _, k := range keys {
+		commands = append(commands, pipeline.HGetAll(ctx, k))
+	}
+	if len(commands) > 0 {
+		_, err := pipeline.Exec(ctx)
 		if err != nil {
 			return nil, err
 		}
-		e := entity{}
-		decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			Result:           &e,
-			WeaklyTypedInput: true,
-		})
-		err = decoder.Decode(result)
+	}
+	entities := make([]*entity, 0, len(commands))
+	for _, cmd := range commands {
+		result := cmd.Val()
+		// index may point to a hash which has already been removed
+		if len(result) == 0 {
+			continue
+		}
+		e, err := decodeEntity(result)
 		if err != nil {
 			return nil, err
 		}
-		entities = append(entities, &e)
+		entities = append(entities, e)
 	}
-
 	return entities, nil
 }
 
+func decodeEntity(m map[string]string) (*entity, error) {
+	e := entity{}
+	decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &e,
+		WeaklyTypedInput: true,
+		DecodeHook:       mapstructure.StringToSliceHookFunc(","),
+	})
+	err := decoder.Decode(m)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
 func buildKeyName(e *entity) string {
 	return fmt.Sprintf("proxy:%v:%v", e.Ip, e.Port)
 }
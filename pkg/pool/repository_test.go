@@ -4,14 +4,17 @@ import (
 	"context"
 	"proxy-pool/config"
 	"proxy-pool/internal/core"
+	"strings"
 	"testing"
 )
 
 func TestService_SaveMany(t *testing.T) {
 	repository := NewRepository(core.ProvideRedis(&config.Config{
-		RedisAddr:     "localhost:6378",
-		RedisPassword: "",
-		RedisDb:       0,
+		Redis: config.RedisConfig{
+			Addr:     "localhost:6378",
+			Password: "",
+			Db:       0,
+		},
 	}))
 	err := repository.saveMany(context.Background(), []*entity{
 		{
@@ -28,3 +31,71 @@ func TestService_SaveMany(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestMergeSources(t *testing.T) {
+	got := mergeSources(splitSources("a,b"), "b", "", "c")
+	if strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("mergeSources() = %v, want [a b c]", got)
+	}
+	if got := mergeSources(splitSources("")); len(got) != 0 {
+		t.Errorf("mergeSources() = %v, want none", got)
+	}
+}
+
+func TestRepository_setSources(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	repo := NewRepository(client)
+	kept := &entity{Ip: "10.0.0.1", Port: 80, Type: Http, Sources: []string{"a", "b"}}
+	removed := &entity{Ip: "10.0.0.2", Port: 80, Type: Http, Sources: []string{"a", "b"}}
+	err := repo.saveMany(ctx, []*entity{kept, removed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.delete(ctx, removed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []*entity{kept, removed} {
+		err = repo.setSources(ctx, e, []string{"b"})
+		if err != nil {
+			t.Fatalf("setSources() error = %v", err)
+		}
+	}
+	sources, _ := client.HGet(ctx, buildKeyName(kept), "sources").Result()
+	if sources != "b" {
+		t.Errorf("sources = %q, want b", sources)
+	}
+	if n, _ := client.Exists(ctx, buildKeyName(removed)).Result(); n != 0 {
+		t.Error("setSources() recreated the hash of a removed proxy")
+	}
+}
+
+func TestRepository_markSeen(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	repo := NewRepository(client)
+	kept := &entity{Ip: "10.0.0.1", Port: 80, Type: Http, Sources: []string{"a"}}
+	removed := &entity{Ip: "10.0.0.2", Port: 80, Type: Http, Sources: []string{"a"}}
+	err := repo.saveMany(ctx, []*entity{kept, removed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.delete(ctx, removed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.markSeen(ctx, []*entity{kept, removed}, "b")
+	if err != nil {
+		t.Fatalf("markSeen() error = %v", err)
+	}
+	sources, _ := client.HGet(ctx, buildKeyName(kept), "sources").Result()
+	if sources != "a,b" {
+		t.Errorf("sources = %q, want a,b", sources)
+	}
+	if n, _ := client.Exists(ctx, buildKeyName(removed)).Result(); n != 0 {
+		t.Error("markSeen() recreated the hash of a removed proxy")
+	}
+}
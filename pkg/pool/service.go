@@ -3,20 +3,45 @@ package pool
 import (
 	"context"
 	"go.uber.org/zap"
+	"io"
+	"proxy-pool/config"
 	"proxy-pool/pkg/log"
+	"time"
 )
 
+// recording a use is left to the background, a slow redis only delays the record
+const usedTimeout = time.Second * 5
+
 type Service struct {
 	repository     *repository
 	fetcherJob     *FetcherJob
 	checkerService *CheckerService
+	events         *EventBus
+	alertService   *AlertService
+	statsService   *StatsService
+	expiryService  *ExpiryService
+	leader         *LeaderElection
 }
 
-func NewPoolService(repo *repository, job *FetcherJob, checker *CheckerService) *Service {
+func NewPoolService(
+	repo *repository,
+	job *FetcherJob,
+	checker *CheckerService,
+	events *EventBus,
+	alerts *AlertService,
+	stats *StatsService,
+	expiry *ExpiryService,
+	leader *LeaderElection,
+) *Service {
 	return &Service{
 		repository:     repo,
 		fetcherJob:     job,
 		checkerService: checker,
+		events:         events,
+		alertService:   alerts,
+		statsService:   stats,
+		expiryService:  expiry,
+		leader:         leader,
 	}
 }
 
@@ -24,18 +49,268 @@ func (s Service) SaveMany(ctx context.Context, entities []*entity) error {
 	return s.repository.saveMany(ctx, entities)
 }
 
-func (s Service) Delete(ctx context.Context, entity *entity) error {
-	log.Logger.Info("removing proxy from pool", zap.String("proxy", entity.GetProxyUri()))
-	return s.repository.delete(ctx, entity)
+func (s Service) Get(ctx context.Context, ip string, port int) (*entity, error) {
+	return s.repository.get(ctx, ip, port)
+}
+
+func (s Service) Delete(ctx context.Context, entity *entity, reason string) error {
+	if entity.session != "" {
+		// a failing session does not tell much about the gateway, the checker decides on it
+		log.Logger.Debug("keeping gateway of failed exit", zap.String("proxy", buildKeyName(entity)), zap.String("reason", reason))
+		s.demoted(ctx, entity, reason)
+		return nil
+	}
+	log.Logger.Info("removing proxy from pool", zap.String("proxy", buildKeyName(entity)), zap.String("reason", reason))
+	err := s.repository.delete(ctx, entity)
+	if err != nil {
+		return err
+	}
+	event := newProxyEvent(EventProxyRemoved, entity)
+	event.Reason = reason
+	s.events.Publish(ctx, event)
+	return nil
 }
 
+// demoted reports a member of the pool which failed but is kept
+func (s Service) demoted(ctx context.Context, entity *entity, reason string) {
+	event := newProxyEvent(EventProxyDemoted, entity)
+	event.Reason = reason
+	s.events.Publish(ctx, event)
+}
+
+// DeleteProxy is Delete for callers outside the package holding the public representation
+func (s Service) DeleteProxy(ctx context.Context, proxy *Proxy, reason string) error {
+	e, err := fromProxy(proxy)
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, e, reason)
+}
+
+// Used records that the proxy has been picked to serve a client. It returns at once,
+// the record is written in the background so the client does not wait for redis
+func (s Service) Used(entity *entity) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), usedTimeout)
+		defer cancel()
+		err := s.repository.markUsed(ctx, entity)
+		if err != nil {
+			log.Logger.Warn("failed to record proxy use", zap.String("proxy", buildKeyName(entity)), zap.Error(err))
+		}
+		s.events.Publish(ctx, newProxyEvent(EventProxySelected, entity))
+	}()
+}
+
+// Subscribe streams pool events published by every replica until ctx is done
+func (s Service) Subscribe(ctx context.Context) <-chan Event {
+	return s.events.Subscribe(ctx)
+}
+
+// GetByRandom returns up to count random proxies which no lease holds, gateways are replaced by random exits
 func (s Service) GetByRandom(ctx context.Context, count int64) ([]*entity, error) {
-	return s.repository.getByRandom(ctx, count)
+	// twice as many leave room for the leased ones
+	entities, err := s.repository.getRandomExits(ctx, count*2)
+	if err != nil {
+		return nil, err
+	}
+	entities, err = s.repository.withoutLeased(ctx, entities)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(entities)) > count {
+		entities = entities[:count]
+	}
+	return entities, nil
 }
 
-func (s Service) Start(ctx context.Context) {
-	s.fetcherJob.Setup()
-	s.checkerService.ProcessQueue(ctx, func(e *entity) error {
-		return s.SaveMany(ctx, []*entity{e})
+func (s Service) List(ctx context.Context, filter Filter) ([]*entity, error) {
+	entities, err := s.repository.getAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*entity, 0, len(entities))
+	for _, e := range entities {
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+		if filter.match(e) {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// Exits lists the proxies matching the filter the way clients use them, gateways as their exits
+func (s Service) Exits(ctx context.Context, filter Filter) ([]*entity, error) {
+	entities, err := s.repository.getAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []*entity
+	for _, e := range entities {
+		for _, exit := range e.exits() {
+			if filter.Limit > 0 && len(result) >= filter.Limit {
+				return result, nil
+			}
+			if filter.match(exit) {
+				result = append(result, exit)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s Service) Export(ctx context.Context, w io.Writer, format Format, filter Filter) error {
+	entities, err := s.Exits(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return Export(w, format, entities)
+}
+
+// Recheck puts the proxy back on the checker queue
+func (s Service) Recheck(ctx context.Context, entity *entity) error {
+	return s.checkerService.Requeue(ctx, entity)
+}
+
+// RecheckProxy is Recheck for callers outside the package holding the public representation
+func (s Service) RecheckProxy(ctx context.Context, proxy *Proxy) error {
+	e, err := fromProxy(proxy)
+	if err != nil {
+		return err
+	}
+	return s.Recheck(ctx, e)
+}
+
+// Fetch asks the replica leading the fetchers to run all of them once
+func (s Service) Fetch(ctx context.Context) error {
+	return s.fetcherJob.RequestFetch(ctx)
+}
+
+// FetchNow runs the named fetcher, or every fetcher when source is empty, and waits for the results
+func (s Service) FetchNow(source string) ([]FetchResult, error) {
+	return s.fetcherJob.Run(source)
+}
+
+// CheckProxy probes the proxy once without changing the pool
+func (s Service) CheckProxy(ctx context.Context, proxy *Proxy) (CheckResult, error) {
+	e, err := fromProxy(proxy)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	return s.checkerService.Probe(ctx, e), nil
+}
+
+func (s Service) Stats(ctx context.Context) (*Stats, error) {
+	entities, err := s.repository.getAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{
+		PoolSize:  len(entities),
+		ByType:    map[Type]int{},
+		ByCountry: map[string]int{},
+	}
+	for _, e := range entities {
+		stats.ByType[e.Type]++
+		stats.ByCountry[e.Country]++
+	}
+	stats.QueueDepth, err = s.checkerService.QueueLength(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.ActiveTunnels, err = s.statsService.activeTunnels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Fetchers, err = s.statsService.fetcherStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.History, err = s.statsService.history(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// FetcherStats returns the run totals of every fetcher, the best pass rate first
+func (s Service) FetcherStats(ctx context.Context) ([]*FetcherStats, error) {
+	return s.statsService.fetcherStats(ctx)
+}
+
+func (s Service) ReportTunnels(ctx context.Context, replica string, count int64) error {
+	return s.statsService.ReportTunnels(ctx, replica, count)
+}
+
+// StartFetcher schedules the fetchers, alerts, stats sampling and expiry and runs the requested fetches
+// while this replica is the leader,
+// so only one replica scrapes the sources however many run. It returns when ctx is done
+func (s Service) StartFetcher(ctx context.Context) {
+	s.leader.Run(ctx, func(ctx context.Context) {
+		s.fetcherJob.Setup(ctx)
+		s.fetcherJob.serveRequests(ctx)
+		go s.alertService.Start(ctx)
+		go s.statsService.Start(ctx)
+		go s.expiryService.Start(ctx)
+		<-ctx.Done()
 	})
+	// the cron scheduler stops once in-flight fetches return
+	s.fetcherJob.Stop()
+}
+
+// StartChecker checks queued proxies until ctx is done, replicas share the queue
+func (s Service) StartChecker(ctx context.Context) {
+	s.checkerService.ProcessQueue(ctx, func(ctx context.Context, e *entity) error {
+		// members of the pool are checked again before they expire
+		known, err := s.repository.exists(ctx, []*entity{e})
+		if err != nil {
+			return err
+		}
+		err = s.SaveMany(ctx, []*entity{e})
+		if err != nil {
+			return err
+		}
+		if !known[0] {
+			s.events.Publish(ctx, newProxyEvent(EventProxyAdded, e))
+		}
+		return nil
+	}, func(ctx context.Context, e *entity) error {
+		known, err := s.repository.exists(ctx, []*entity{e})
+		if err != nil {
+			return err
+		}
+		if known[0] {
+			s.demoted(ctx, e, ReasonCheckFailed)
+		}
+		return nil
+	})
+}
+
+// Reload applies the parts of cfg which can change at runtime: the fetchers with their schedules
+// and the check url and timeout. The other settings keep their values until a restart
+func (s Service) Reload(cfg *config.Config) {
+	s.ReloadFetchers(cfg)
+	s.ReloadChecker(cfg)
+}
+
+// ReloadFetchers replaces the fetchers and their schedules with the ones of cfg
+func (s Service) ReloadFetchers(cfg *config.Config) {
+	s.fetcherJob.Reload(cfg)
+	log.Logger.Info("reloaded fetchers", zap.Int("fetchers", len(s.fetcherJob.registerFetchers())))
+}
+
+// ReloadChecker applies the check url and timeout of cfg to the next checks
+func (s Service) ReloadChecker(cfg *config.Config) {
+	s.checkerService.Reload(cfg)
+	log.Logger.Info("reloaded checker",
+		zap.String("check_url", cfg.Checker.Url),
+		zap.Duration("check_timeout", cfg.Checker.Timeout),
+	)
+}
+
+// Start runs the fetcher and checker roles in one process
+func (s Service) Start(ctx context.Context) {
+	go s.StartFetcher(ctx)
+	s.StartChecker(ctx)
 }
@@ -0,0 +1,215 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"proxy-pool/pkg/log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	poolSizeHistoryKey     = "stats:pool:size"
+	fetcherStatsIndexKey   = "stats:fetcher:set"
+	fetcherStatsKeyPrefix  = "stats:fetcher:"
+	tunnelStatsKeyPrefix   = "stats:tunnel:"
+	poolSizeSampleInterval = time.Minute
+	// one day of samples
+	poolSizeHistoryLength = 1440
+	// replicas report their tunnels more often than this, so a dead replica drops out
+	tunnelStatsTtl = time.Second * 30
+)
+
+type PoolSizeSample struct {
+	Time int64 `json:"time"`
+	Size int64 `json:"size"`
+}
+
+type FetcherStats struct {
+	Name      string `json:"name"`
+	Runs      int64  `json:"runs"`
+	Failures  int64  `json:"failures"`
+	LastRun   int64  `json:"last_run"`
+	LastCount int64  `json:"last_count"`
+	// milliseconds
+	LastDuration int64  `json:"last_duration"`
+	LastError    string `json:"last_error,omitempty"`
+	// totals over all runs
+	Fetched    int64 `json:"fetched"`
+	Duplicates int64 `json:"duplicates"`
+	Enqueued   int64 `json:"enqueued"`
+	Passed     int64 `json:"passed"`
+	Failed     int64 `json:"failed"`
+	// share of the checked proxies which passed the checker
+	PassRate float64 `json:"pass_rate"`
+}
+
+type Stats struct {
+	PoolSize      int              `json:"pool_size"`
+	ByType        map[Type]int     `json:"by_type"`
+	ByCountry     map[string]int   `json:"by_country"`
+	QueueDepth    int64            `json:"queue_depth"`
+	ActiveTunnels int64            `json:"active_tunnels"`
+	Fetchers      []*FetcherStats  `json:"fetchers"`
+	History       []PoolSizeSample `json:"history"`
+}
+
+type StatsService struct {
+	redis *redis.Client
+}
+
+func NewStatsService(redis *redis.Client) *StatsService {
+	return &StatsService{redis: redis}
+}
+
+// Start samples the pool size until ctx is done
+func (s StatsService) Start(ctx context.Context) {
+	ticker := time.NewTicker(poolSizeSampleInterval)
+	defer ticker.Stop()
+	for {
+		s.samplePoolSize(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s StatsService) samplePoolSize(ctx context.Context) {
+	size, err := s.redis.SCard(ctx, indexKey).Result()
+	if err != nil {
+		log.Logger.Warn("failed to sample pool size", zap.Error(err))
+		return
+	}
+	bytes, _ := json.Marshal(PoolSizeSample{Time: time.Now().Unix(), Size: size})
+	pipeline := s.redis.Pipeline()
+	pipeline.RPush(ctx, poolSizeHistoryKey, string(bytes))
+	pipeline.LTrim(ctx, poolSizeHistoryKey, -poolSizeHistoryLength, -1)
+	_, err = pipeline.Exec(ctx)
+	if err != nil {
+		log.Logger.Warn("failed to save pool size sample", zap.Error(err))
+	}
+}
+
+func (s StatsService) recordFetcherRun(ctx context.Context, result FetchResult) {
+	key := fetcherStatsKeyPrefix + result.Name
+	pipeline := s.redis.Pipeline()
+	pipeline.SAdd(ctx, fetcherStatsIndexKey, result.Name)
+	pipeline.HIncrBy(ctx, key, "runs", 1)
+	pipeline.HIncrBy(ctx, key, "fetched", int64(result.Count))
+	pipeline.HIncrBy(ctx, key, "duplicates", int64(result.Duplicates))
+	pipeline.HIncrBy(ctx, key, "enqueued", int64(result.Enqueued))
+	pipeline.HSet(ctx, key,
+		"last_run", time.Now().Unix(),
+		"last_count", result.Count,
+		"last_duration", result.Duration.Milliseconds(),
+	)
+	if result.Err != nil {
+		pipeline.HIncrBy(ctx, key, "failures", 1)
+		pipeline.HSet(ctx, key, "last_error", result.Err.Error())
+	} else {
+		pipeline.HDel(ctx, key, "last_error")
+	}
+	_, err := pipeline.Exec(ctx)
+	if err != nil {
+		log.Logger.Warn("failed to record fetcher stats", zap.String("name", result.Name), zap.Error(err))
+	}
+}
+
+// recordCheck attributes a checker result to the fetcher which found the proxy
+func (s StatsService) recordCheck(ctx context.Context, source string, passed bool) {
+	if source == "" {
+		return
+	}
+	field := "failed"
+	if passed {
+		field = "passed"
+	}
+	err := s.redis.HIncrBy(ctx, fetcherStatsKeyPrefix+source, field, 1).Err()
+	if err != nil {
+		log.Logger.Warn("failed to record check result", zap.String("name", source), zap.Error(err))
+	}
+}
+
+// ReportTunnels publishes the number of open tunnels of one proxy replica
+func (s StatsService) ReportTunnels(ctx context.Context, replica string, count int64) error {
+	return s.redis.Set(ctx, tunnelStatsKeyPrefix+replica, count, tunnelStatsTtl).Err()
+}
+
+func (s StatsService) activeTunnels(ctx context.Context) (int64, error) {
+	var total int64
+	iter := s.redis.Scan(ctx, 0, tunnelStatsKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		count, err := s.redis.Get(ctx, iter.Val()).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return 0, err
+		}
+		total += count
+	}
+	return total, iter.Err()
+}
+
+func (s StatsService) fetcherStats(ctx context.Context) ([]*FetcherStats, error) {
+	names, err := s.redis.SMembers(ctx, fetcherStatsIndexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*FetcherStats, 0, len(names))
+	for _, name := range names {
+		m, err := s.redis.HGetAll(ctx, fetcherStatsKeyPrefix+name).Result()
+		if err != nil {
+			return nil, err
+		}
+		stats := &FetcherStats{
+			Name:         name,
+			Runs:         parseInt64(m["runs"]),
+			Failures:     parseInt64(m["failures"]),
+			LastRun:      parseInt64(m["last_run"]),
+			LastCount:    parseInt64(m["last_count"]),
+			LastDuration: parseInt64(m["last_duration"]),
+			LastError:    m["last_error"],
+			Fetched:      parseInt64(m["fetched"]),
+			Duplicates:   parseInt64(m["duplicates"]),
+			Enqueued:     parseInt64(m["enqueued"]),
+			Passed:       parseInt64(m["passed"]),
+			Failed:       parseInt64(m["failed"]),
+		}
+		if checked := stats.Passed + stats.Failed; checked > 0 {
+			stats.PassRate = float64(stats.Passed) / float64(checked)
+		}
+		result = append(result, stats)
+	}
+	// best sources first
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].PassRate != result[j].PassRate {
+			return result[i].PassRate > result[j].PassRate
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (s StatsService) history(ctx context.Context) ([]PoolSizeSample, error) {
+	values, err := s.redis.LRange(ctx, poolSizeHistoryKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]PoolSizeSample, 0, len(values))
+	for _, v := range values {
+		sample := PoolSizeSample{}
+		if json.Unmarshal([]byte(v), &sample) == nil {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, nil
+}
+
+func parseInt64(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
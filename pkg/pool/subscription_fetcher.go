@@ -0,0 +1,155 @@
+package pool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+	"io"
+	"net/http"
+	"net/url"
+	"proxy-pool/config"
+	"proxy-pool/pkg/log"
+	"strconv"
+	"strings"
+)
+
+const ParserSubscription = "subscription"
+
+// SubscriptionFetcher reads clash configs and base64 encoded uri lists published for proxy clients.
+// Only http, https and socks5 entries are usable by the pool, the others are counted and skipped
+type SubscriptionFetcher struct {
+	source config.SourceConfig
+}
+
+func NewSubscriptionFetcher(source config.SourceConfig) (*SubscriptionFetcher, error) {
+	if source.Name == "" || source.Url == "" {
+		return nil, fmt.Errorf("%w: name and url are required", ErrInvalidSource)
+	}
+	return &SubscriptionFetcher{source: source}, nil
+}
+
+func (s SubscriptionFetcher) Name() string {
+	return s.source.Name
+}
+
+func (s SubscriptionFetcher) Get(ctx context.Context) ([]*entity, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(ctx).Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v from %v", resp.Status, s.source.Url)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	entities, skipped, err := parseSubscription(body)
+	if skipped > 0 {
+		log.Logger.Info("skipped unsupported subscription entries", zap.String("name", s.source.Name), zap.Int("count", skipped))
+	}
+	return entities, err
+}
+
+// clashConfig is the part of a clash config the pool reads, the entries share the format of the clash export
+type clashConfig struct {
+	Proxies []clashProxy `yaml:"proxies"`
+}
+
+// parseSubscription returns the usable entries and the number of skipped ones
+func parseSubscription(body []byte) ([]*entity, int, error) {
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte("proxies:")) || bytes.Contains(trimmed, []byte("\nproxies:")) {
+		return parseClash(trimmed)
+	}
+	if decoded, ok := decodeBase64(trimmed); ok {
+		trimmed = decoded
+	}
+	return parseUriLines(trimmed)
+}
+
+func parseClash(body []byte) ([]*entity, int, error) {
+	cfg := clashConfig{}
+	err := yaml.Unmarshal(body, &cfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	var entities []*entity
+	skipped := 0
+	for _, p := range cfg.Proxies {
+		var t Type
+		switch {
+		case p.Type == "http" && p.Tls:
+			t = Https
+		case p.Type == "http":
+			t = Http
+		case p.Type == "socks5":
+			t = Socks5
+		default:
+			skipped++
+			continue
+		}
+		e, err := fromProxy(&Proxy{Ip: p.Server, Port: p.Port, Type: t, Username: p.Username, Password: p.Password})
+		if err != nil {
+			skipped++
+			continue
+		}
+		entities = append(entities, e)
+	}
+	return entities, skipped, nil
+}
+
+func parseUriLines(body []byte) ([]*entity, int, error) {
+	var entities []*entity
+	skipped := 0
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			skipped++
+			continue
+		}
+		port, _ := strconv.Atoi(u.Port())
+		password, _ := u.User.Password()
+		e, err := fromProxy(&Proxy{
+			Ip:       u.Hostname(),
+			Port:     port,
+			Type:     Type(u.Scheme),
+			Username: u.User.Username(),
+			Password: password,
+		})
+		if err != nil {
+			skipped++
+			continue
+		}
+		entities = append(entities, e)
+	}
+	return entities, skipped, scanner.Err()
+}
+
+// decodeBase64 accepts the padded and unpadded, standard and url safe alphabets subscriptions use
+func decodeBase64(body []byte) ([]byte, bool) {
+	s := strings.Join(strings.Fields(string(body)), "")
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		decoded, err := encoding.DecodeString(s)
+		if err == nil {
+			return decoded, true
+		}
+	}
+	return nil, false
+}
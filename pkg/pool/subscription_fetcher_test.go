@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestParseSubscription(t *testing.T) {
+	clash := `port: 7890
+proxies:
+  - {name: a, type: http, server: 1.1.1.1, port: 8080, username: u, password: p}
+  - {name: b, type: http, server: 2.2.2.2, port: 443, tls: true}
+  - {name: c, type: socks5, server: 3.3.3.3, port: 1080}
+  - {name: d, type: ss, server: 4.4.4.4, port: 8388, cipher: aes-128-gcm, password: x}
+  - {name: e, type: vmess, server: 5.5.5.5, port: 443, uuid: abc}
+`
+	uris := "http://u:p@1.1.1.1:8080\nvmess://eyJhZGQiOiI1LjUuNS41In0=\nsocks5://3.3.3.3:1080\ntrojan://pw@6.6.6.6:443\n"
+	tests := []struct {
+		name        string
+		body        string
+		want        []*entity
+		wantSkipped int
+	}{
+		{
+			name: "clash",
+			body: clash,
+			want: []*entity{
+				{Ip: "1.1.1.1", Port: 8080, Type: Http, Username: "u", Password: "p"},
+				{Ip: "2.2.2.2", Port: 443, Type: Https},
+				{Ip: "3.3.3.3", Port: 1080, Type: Socks5},
+			},
+			wantSkipped: 2,
+		},
+		{
+			name: "base64",
+			body: base64.StdEncoding.EncodeToString([]byte(uris)),
+			want: []*entity{
+				{Ip: "1.1.1.1", Port: 8080, Type: Http, Username: "u", Password: "p"},
+				{Ip: "3.3.3.3", Port: 1080, Type: Socks5},
+			},
+			wantSkipped: 2,
+		},
+		{
+			name: "unpadded url safe base64",
+			body: base64.RawURLEncoding.EncodeToString([]byte("socks5://3.3.3.3:1080")),
+			want: []*entity{{Ip: "3.3.3.3", Port: 1080, Type: Socks5}},
+		},
+		{
+			name:        "plain",
+			body:        uris,
+			want:        []*entity{{Ip: "1.1.1.1", Port: 8080, Type: Http, Username: "u", Password: "p"}, {Ip: "3.3.3.3", Port: 1080, Type: Socks5}},
+			wantSkipped: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped, err := parseSubscription([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || skipped != tt.wantSkipped {
+				t.Errorf("parseSubscription() = %v, %v, want %v, %v", got, skipped, tt.want, tt.wantSkipped)
+			}
+		})
+	}
+}
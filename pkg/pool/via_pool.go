@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"proxy-pool/pkg/log"
+)
+
+const defaultViaPoolRetries = 3
+
+type transportKey struct{}
+
+// withTransport makes the fetchers send their requests through rt
+func withTransport(ctx context.Context, rt http.RoundTripper) context.Context {
+	return context.WithValue(ctx, transportKey{}, rt)
+}
+
+func transportFrom(ctx context.Context) http.RoundTripper {
+	if rt, ok := ctx.Value(transportKey{}).(http.RoundTripper); ok {
+		return rt
+	}
+	return http.DefaultTransport
+}
+
+// httpClient returns the client fetchers use for their requests
+func httpClient(ctx context.Context) *http.Client {
+	return &http.Client{Transport: transportFrom(ctx)}
+}
+
+// poolTransport sends each request through a random proxy of the pool,
+// a failed attempt is retried through another one
+type poolTransport struct {
+	repository *repository
+	// upstreams tried for one request, the first one and the retries
+	attempts int
+}
+
+// blocked tells whether the upstream or the site refused the request, another upstream may succeed
+func blocked(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusProxyAuthRequired, http.StatusTooManyRequests:
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+func (t poolTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	// the pool is small enough to fetch some spares, upstreams which failed are skipped
+	candidates, err := t.repository.getRandomExits(ctx, int64(t.attempts*2))
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, ErrEmptyPool
+	}
+	tried := map[string]bool{}
+	var lastErr error
+	for _, e := range candidates {
+		if len(tried) >= t.attempts {
+			break
+		}
+		key := leaseKeyName(e)
+		if tried[key] {
+			continue
+		}
+		if len(tried) > 0 && request.Body != nil && request.GetBody == nil {
+			// the first attempt consumed the body, the request can not be sent again
+			return nil, lastErr
+		}
+		tried[key] = true
+		// a RoundTripper must not modify the request, each attempt sends a copy with a fresh body
+		attempt := request.Clone(ctx)
+		if request.Body != nil && len(tried) > 1 {
+			attempt.Body, err = request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err := e.transport().RoundTrip(attempt)
+		if err == nil && !blocked(resp) {
+			return resp, nil
+		}
+		if err == nil {
+			_ = resp.Body.Close()
+			err = fmt.Errorf("upstream answered %v", resp.Status)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Logger.Debug("fetch through pool failed",
+			zap.String("proxy", key), zap.String("url", request.URL.String()), zap.Error(err))
+		lastErr = err
+	}
+	return nil, fmt.Errorf("%v attempts through the pool failed: %w", len(tried), lastErr)
+}
@@ -0,0 +1,121 @@
+package pool
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestUpstream is an http proxy answering every request itself, it refuses users for which allow is false
+func newTestUpstream(t *testing.T, allow func(user string) bool) *entity {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := ""
+		if header := r.Header.Get("Proxy-Authorization"); strings.HasPrefix(header, "Basic ") {
+			decoded, _ := base64.StdEncoding.DecodeString(header[len("Basic "):])
+			user = strings.SplitN(string(decoded), ":", 2)[0]
+		}
+		if !allow(user) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	t.Cleanup(upstream.Close)
+	return &entity{Ip: "127.0.0.1", Port: upstream.Listener.Addr().(*net.TCPAddr).Port, Type: Http}
+}
+
+func TestPoolTransport_RoundTrip_gateway(t *testing.T) {
+	gateway := newTestUpstream(t, func(user string) bool {
+		return strings.HasPrefix(user, "customer-session-") && !strings.Contains(user, sessionPlaceholder)
+	})
+	gateway.Username = "customer-session-" + sessionPlaceholder
+	gateway.Password = "secret"
+	gateway.Sessions = 5
+	repo := NewRepository(newTestRedis(t))
+	err := repo.saveMany(context.Background(), []*entity{gateway})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: poolTransport{repository: repo, attempts: 3}}
+	resp, err := client.Get("http://example.invalid/list")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("Get() = %v %q, want 200 through a gateway exit", resp.Status, body)
+	}
+}
+
+func TestPoolTransport_RoundTrip_retry(t *testing.T) {
+	var refused int32
+	failing := newTestUpstream(t, func(string) bool {
+		atomic.AddInt32(&refused, 1)
+		return false
+	})
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	}))
+	t.Cleanup(echo.Close)
+	working := &entity{Ip: "127.0.0.1", Port: echo.Listener.Addr().(*net.TCPAddr).Port, Type: Http}
+	repo := NewRepository(newTestRedis(t))
+	err := repo.saveMany(context.Background(), []*entity{failing, working})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := poolTransport{repository: repo, attempts: 2}
+	// the pool is shuffled on every request, some of them try the failing upstream first
+	for i := 0; i < 20; i++ {
+		request, _ := http.NewRequest(http.MethodPost, "http://example.invalid/list", strings.NewReader("body"))
+		body := request.Body
+		resp, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatalf("RoundTrip() error = %v", err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(got) != "body" {
+			t.Errorf("RoundTrip() = %v %q, want 200 with the body sent again", resp.Status, got)
+		}
+		if request.Body != body {
+			t.Error("RoundTrip() replaced the body of the request")
+		}
+	}
+	if atomic.LoadInt32(&refused) == 0 {
+		t.Error("failing upstream was never tried")
+	}
+}
+
+func TestPoolTransport_RoundTrip_bodyNotReplayable(t *testing.T) {
+	var refused int32
+	refuse := func(string) bool {
+		atomic.AddInt32(&refused, 1)
+		return false
+	}
+	repo := NewRepository(newTestRedis(t))
+	err := repo.saveMany(context.Background(), []*entity{newTestUpstream(t, refuse), newTestUpstream(t, refuse)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.invalid/list", nil)
+	// without GetBody the body is gone after the first attempt
+	request.Body = io.NopCloser(strings.NewReader("body"))
+	_, err = poolTransport{repository: repo, attempts: 2}.RoundTrip(request)
+	if err == nil || strings.Contains(err.Error(), "attempts") {
+		t.Errorf("RoundTrip() error = %v, want the error of the only attempt", err)
+	}
+	if got := atomic.LoadInt32(&refused); got != 1 {
+		t.Errorf("upstreams tried = %v, want 1", got)
+	}
+}